@@ -0,0 +1,75 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package automaton computes the derivatives of relapse grammars while it walks an input,
+// the way in which katydid's mem package validates, to show which patterns the fields are matched against.
+// The derivatives and their simplification are not katydid's, but its own,
+// so the patterns approximate katydid's validation, instead of being the steps which katydid takes.
+// The input is validated with katydid as well, so that Trace and Match return an error when the two disagree.
+//
+// The patterns at a depth are the patterns which the fields at that depth are matched against.
+// When a field is entered, the name or value conditions of the patterns are evaluated on the label of the field,
+// which gives the patterns which the children of the field are matched against.
+// When the field is left, whether those patterns are nullable gives the patterns of the next sibling.
+package automaton
+
+import (
+	"fmt"
+
+	"github.com/katydid/katydid/relapse/ast"
+)
+
+// load converts the pattern declarations and the TopPattern, which is stored as main, of the grammar.
+func load(g *ast.Grammar) (*patterns, error) {
+	ps := newPatterns()
+	for _, pdecl := range g.PatternDecls {
+		p, err := ps.convert(pdecl.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("#%s: %v", pdecl.Name, err)
+		}
+		ps.refs[pdecl.Name] = p
+	}
+	if g.TopPattern != nil {
+		p, err := ps.convert(g.TopPattern)
+		if err != nil {
+			return nil, err
+		}
+		ps.refs["main"] = p
+	}
+	if _, ok := ps.refs["main"]; !ok {
+		return nil, fmt.Errorf("the grammar has no main pattern")
+	}
+	for name, p := range ps.refs {
+		if err := ps.checkReferences(p); err != nil {
+			return nil, fmt.Errorf("#%s: %v", name, err)
+		}
+	}
+	ps.resolveNullable()
+	return ps, nil
+}
+
+// checkReferences returns an error if the pattern refers to an undefined pattern.
+func (ps *patterns) checkReferences(p *pattern) error {
+	if p.kind == reference {
+		if _, ok := ps.refs[p.ref]; !ok {
+			return fmt.Errorf("reference to undefined pattern @%s", p.ref)
+		}
+	}
+	for _, c := range p.children {
+		if err := ps.checkReferences(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package automaton
+
+import (
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	"github.com/katydid/katydid/parser"
+	"github.com/katydid/katydid/parser/json"
+	protoparser "github.com/katydid/katydid/parser/proto"
+	"github.com/katydid/katydid/parser/xml"
+	"github.com/katydid/katydid/relapse"
+	"github.com/katydid/katydid/relapse/ast"
+	"github.com/katydid/katydid/relapse/mem"
+)
+
+func TestLoadErrors(t *testing.T) {
+	for _, s := range []string{
+		`#main = @other`,
+		`#other = *`,
+	} {
+		g, err := relapse.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := load(g); err == nil {
+			t.Fatalf("expected an error for %s", s)
+		}
+	}
+}
+
+// samples are grammars with inputs to validate, some of which are valid.
+var samples = map[string][]string{
+	`.A == "x"`:                       {`{"A":"x"}`, `{"A":"y"}`, `{"B":"x"}`, `{}`},
+	`(.A: * | .B: *)`:                 {`{"A":1}`, `{"B":1}`, `{"C":1}`, `{"A":1,"B":2}`},
+	`{.A: *; .B: *}`:                  {`{"A":1,"B":2}`, `{"B":2,"A":1}`, `{"A":1}`, `{"A":1,"B":2,"C":3}`},
+	`[.A == "x", (.B: *)*]`:           {`{"A":"x"}`, `{"A":"x","B":1}`, `{"B":1}`},
+	`!(.A: *)`:                        {`{"A":1}`, `{"B":1}`, `{}`},
+	`#main = (.A: @main | .B == "x")`: {`{"A":{"A":{"B":"x"}}}`, `{"A":{"B":"y"}}`, `{"B":"x"}`},
+}
+
+func jsonParser(t *testing.T, input string) json.JsonParser {
+	t.Helper()
+	p := json.NewJsonParser()
+	if err := p.Init([]byte(input)); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// katydid validates the input with katydid's mem package.
+func katydid(t *testing.T, g *ast.Grammar, p parser.Interface) bool {
+	t.Helper()
+	m, err := mem.New(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, err := m.Validate(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return valid
+}
+
+func TestTrace(t *testing.T) {
+	g, err := relapse.Parse(`.A == "x"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for input, valid := range map[string]bool{
+		`{"A":"x"}`: true,
+		`{"A":"y"}`: false,
+		`{"B":"x"}`: false,
+	} {
+		p := json.NewJsonParser()
+		if err := p.Init([]byte(input)); err != nil {
+			t.Fatal(err)
+		}
+		steps, err := Trace(g, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// start, enter and leave A and enter and leave its value
+		if len(steps) != 5 {
+			t.Fatalf("expected 5 steps for %s, but got %d", input, len(steps))
+		}
+		if len(steps[2].Path) != 2 || len(steps[2].Patterns) != 3 {
+			t.Fatalf("expected the value of the field to be two levels deep, but got %v", steps[2].Path)
+		}
+		last := steps[len(steps)-1]
+		if last.Valid() != valid {
+			t.Fatalf("expected valid to be %v for %s, but got %s", valid, input, last.Patterns[0][0])
+		}
+	}
+}
+
+func TestTraceKatydid(t *testing.T) {
+	for s, inputs := range samples {
+		g, err := relapse.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, input := range inputs {
+			steps, err := Trace(g, jsonParser(t, input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if valid, want := steps[len(steps)-1].Valid(), katydid(t, g, jsonParser(t, input)); valid != want {
+				t.Fatalf("expected the trace of %s to validate %s as %v, like katydid, but got %v", s, input, want, valid)
+			}
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	g, err := relapse.Parse(`[.A == "x", .B: *]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := g.TopPattern.Concat.LeftPattern.Contains.Pattern.TreeNode
+	b := g.TopPattern.Concat.RightPattern.Contains.Pattern.TreeNode
+	for input, want := range map[string][2]Status{
+		`{"A":"x","B":1}`: {Matched, Matched},
+		`{"A":"y","B":1}`: {Failed, Unreached},
+		`{"A":"x"}`:       {Matched, Failed},
+	} {
+		p := json.NewJsonParser()
+		if err := p.Init([]byte(input)); err != nil {
+			t.Fatal(err)
+		}
+		r, err := Match(g, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := [2]Status{r.Status(a), r.Status(b)}; got != want {
+			t.Fatalf("expected A and B to be %v for %s, but got %v", want, input, got)
+		}
+		if r.Valid != (want[1] == Matched) {
+			t.Fatalf("expected valid to be %v for %s", !r.Valid, input)
+		}
+	}
+}
+
+func TestMatchNot(t *testing.T) {
+	g, err := relapse.Parse(`!(.A: *)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := g.TopPattern.Not.Pattern.Contains.Pattern.TreeNode
+	r, err := Match(g, jsonParser(t, `{"A":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A matched, which made the input invalid, but it did not fail itself
+	if r.Valid || r.Status(a) != Matched {
+		t.Fatalf("expected A to be matched in an invalid input, but got %v and valid %v", r.Status(a), r.Valid)
+	}
+}
+
+func TestMatchKatydid(t *testing.T) {
+	for s, inputs := range samples {
+		g, err := relapse.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, input := range inputs {
+			r, err := Match(g, jsonParser(t, input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := katydid(t, g, jsonParser(t, input)); r.Valid != want {
+				t.Fatalf("expected the match of %s to validate %s as %v, like katydid, but got %v", s, input, want, r.Valid)
+			}
+		}
+	}
+}
+
+func TestMatchXML(t *testing.T) {
+	g, err := relapse.Parse(`.A == "x"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := g.TopPattern.Contains.Pattern.TreeNode
+	xmlParser := func(input string) xml.XMLParser {
+		p := xml.NewXMLParser()
+		if err := p.Init([]byte(input)); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	for input, valid := range map[string]bool{
+		`<A>x</A>`: true,
+		`<A>y</A>`: false,
+		`<B>x</B>`: false,
+	} {
+		r, err := Match(g, xmlParser(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := katydid(t, g, xmlParser(input)); r.Valid != want || want != valid {
+			t.Fatalf("expected %s to be valid %v, like katydid %v, but got %v", input, valid, want, r.Valid)
+		}
+		if valid && r.Status(a) != Matched {
+			t.Fatalf("expected A to be matched in %s, but got %v", input, r.Status(a))
+		}
+	}
+}
+
+func TestMatchProto(t *testing.T) {
+	g, err := relapse.Parse(`.A == "x"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := g.TopPattern.Contains.Pattern.TreeNode
+	// message test.M { optional string A = 1; }
+	desc := &descriptor.FileDescriptorSet{File: []*descriptor.FileDescriptorProto{{
+		Name:    proto.String("test.proto"),
+		Package: proto.String("test"),
+		MessageType: []*descriptor.DescriptorProto{{
+			Name: proto.String("M"),
+			Field: []*descriptor.FieldDescriptorProto{{
+				Name:   proto.String("A"),
+				Number: proto.Int32(1),
+				Label:  descriptor.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:   descriptor.FieldDescriptorProto_TYPE_STRING.Enum(),
+			}},
+		}},
+	}}}
+	protoParser := func(input []byte) protoparser.ProtoParser {
+		p, err := protoparser.NewProtoParser("test", "M", desc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Init(input); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	for _, c := range []struct {
+		input []byte
+		valid bool
+	}{
+		{[]byte{0x0a, 0x01, 'x'}, true},
+		{[]byte{0x0a, 0x01, 'y'}, false},
+		{[]byte{}, false},
+	} {
+		r, err := Match(g, protoParser(c.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := katydid(t, g, protoParser(c.input)); r.Valid != want || want != c.valid {
+			t.Fatalf("expected %x to be valid %v, like katydid %v, but got %v", c.input, c.valid, want, r.Valid)
+		}
+		if c.valid && r.Status(a) != Matched {
+			t.Fatalf("expected A to be matched in %x, but got %v", c.input, r.Status(a))
+		}
+	}
+}
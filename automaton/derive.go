@@ -0,0 +1,142 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package automaton
+
+import (
+	"fmt"
+)
+
+// ifExpr is the pattern which the children of a field are matched against,
+// depending on whether the condition holds for the label of the field.
+type ifExpr struct {
+	cond *pattern
+	then *pattern
+	els  *pattern
+}
+
+// deriveCall returns the conditional patterns which the children of a field are matched against,
+// when the field is matched against the patterns.
+func (ps *patterns) deriveCall(in []*pattern) ([]ifExpr, error) {
+	var ifs []ifExpr
+	for _, p := range in {
+		var err error
+		if ifs, err = ps.call(p, ifs, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ifs, nil
+}
+
+// call appends the conditional patterns of the pattern,
+// where refs are the references which were followed without passing a node, to detect left recursion.
+func (ps *patterns) call(p *pattern, ifs []ifExpr, refs []string) ([]ifExpr, error) {
+	var err error
+	switch p.kind {
+	case empty, zany, none:
+		return ifs, nil
+	case node:
+		return append(ifs, ifExpr{p, p.children[0], ps.none()}), nil
+	case leaf:
+		return append(ifs, ifExpr{p, ps.empty(), ps.none()}), nil
+	case concat:
+		if ifs, err = ps.call(p.children[0], ifs, refs); err != nil {
+			return nil, err
+		}
+		if ps.nullable(p.children[0]) {
+			return ps.call(p.children[1], ifs, refs)
+		}
+		return ifs, nil
+	case or, and, interleave:
+		for _, c := range p.children {
+			if ifs, err = ps.call(c, ifs, refs); err != nil {
+				return nil, err
+			}
+		}
+		return ifs, nil
+	case zeroOrMore, not:
+		return ps.call(p.children[0], ifs, refs)
+	case reference:
+		for _, r := range refs {
+			if r == p.ref {
+				return nil, fmt.Errorf("left recursive reference to @%s", p.ref)
+			}
+		}
+		return ps.call(ps.refs[p.ref], ifs, append(refs, p.ref))
+	}
+	panic(fmt.Sprintf("unknown pattern kind %d", p.kind))
+}
+
+// deriveReturn returns the derivatives of the patterns,
+// given whether the children of the field matched each of the conditional patterns of deriveCall.
+func (ps *patterns) deriveReturn(in []*pattern, nullable []bool) []*pattern {
+	out := make([]*pattern, len(in))
+	for i, p := range in {
+		out[i], nullable = ps.ret(p, nullable)
+	}
+	return out
+}
+
+// ret returns the derivative of the pattern, consuming the nullability of its conditional patterns.
+func (ps *patterns) ret(p *pattern, nullable []bool) (*pattern, []bool) {
+	switch p.kind {
+	case empty, none:
+		return ps.none(), nullable
+	case zany:
+		return p, nullable
+	case node, leaf:
+		if nullable[0] {
+			return ps.empty(), nullable[1:]
+		}
+		return ps.none(), nullable[1:]
+	case concat:
+		a, b := p.children[0], p.children[1]
+		da, nullable := ps.ret(a, nullable)
+		d := ps.concat(da, b)
+		if !ps.nullable(a) {
+			return d, nullable
+		}
+		db, nullable := ps.ret(b, nullable)
+		return ps.or(d, db), nullable
+	case or, and:
+		ds := make([]*pattern, len(p.children))
+		for i, c := range p.children {
+			ds[i], nullable = ps.ret(c, nullable)
+		}
+		if p.kind == or {
+			return ps.or(ds...), nullable
+		}
+		return ps.and(ds...), nullable
+	case interleave:
+		// one of the interleaved patterns matches the field, while the others are left as they are
+		alts := make([]*pattern, len(p.children))
+		for i, c := range p.children {
+			var d *pattern
+			d, nullable = ps.ret(c, nullable)
+			cs := append([]*pattern{}, p.children...)
+			cs[i] = d
+			alts[i] = ps.interleave(cs...)
+		}
+		return ps.or(alts...), nullable
+	case zeroOrMore:
+		d, nullable := ps.ret(p.children[0], nullable)
+		return ps.concat(d, p), nullable
+	case not:
+		d, nullable := ps.ret(p.children[0], nullable)
+		return ps.not(d), nullable
+	case reference:
+		return ps.ret(ps.refs[p.ref], nullable)
+	}
+	panic(fmt.Sprintf("unknown pattern kind %d", p.kind))
+}
@@ -0,0 +1,160 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package automaton
+
+import (
+	"fmt"
+
+	"github.com/katydid/katydid/relapse/ast"
+)
+
+// Status is how a TreeNode or LeafNode of a grammar took part in the validation of an input.
+type Status int
+
+const (
+	// Unreached nodes were never tried against a field.
+	Unreached Status = iota
+	// Reached nodes were tried against a field, but neither matched a field nor caused the validation to fail.
+	Reached
+	// Matched nodes matched at least one field, which is their name or value and their children.
+	Matched
+	// Failed nodes caused the validation to fail.
+	Failed
+)
+
+func (s Status) String() string {
+	switch s {
+	case Unreached:
+		return "unreached"
+	case Reached:
+		return "reached"
+	case Matched:
+		return "matched"
+	case Failed:
+		return "failed"
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// Result is how the TreeNode and LeafNode nodes of a grammar took part in the validation of an input.
+type Result struct {
+	// Valid is set if the input is valid, which Match checks that katydid agrees with.
+	Valid    bool
+	statuses map[interface{}]Status
+}
+
+// Status returns the status of the *ast.TreeNode or *ast.LeafNode, where nodes which are not part of the grammar are Unreached.
+func (r *Result) Status(node interface{}) Status {
+	return r.statuses[node]
+}
+
+// Match validates the input against the grammar, in the same way as Trace,
+// and returns how every TreeNode and LeafNode took part in the validation.
+// When the input is invalid, the failure is explained from the field at which the top level pattern stopped matching,
+// where the nodes for which the name or value did not hold, or for which the children did not match, failed,
+// following the failure down into the children.
+// If the fields ended before a pattern was matched, the nodes which it still expected failed.
+// No node fails when the nodes at the failing field all matched, such as when the input matches the pattern inside a Not.
+// Identical nodes, such as two .A: * in different pattern declarations, share the same status.
+// The statuses come from the derivatives of this package, which approximate katydid's validation,
+// where only the validity of the input is checked against katydid's mem package,
+// and a *MismatchError is returned if the two disagree.
+func Match(g *ast.Grammar, p Parser) (*Result, error) {
+	ps, err := load(g)
+	if err != nil {
+		return nil, err
+	}
+	katydid, err := validateWithKatydid(g, p)
+	if err != nil {
+		return nil, err
+	}
+	t := newTracer(ps)
+	top := &level{}
+	if err := t.walk(p, top); err != nil {
+		return nil, err
+	}
+	r := &Result{
+		Valid:    ps.nullable(top.end[0]),
+		statuses: make(map[interface{}]Status),
+	}
+	if r.Valid != katydid {
+		return nil, &MismatchError{Valid: r.Valid, Katydid: katydid}
+	}
+	r.reach(ps, top)
+	if !r.Valid {
+		if err := r.explain(ps, top, 0); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// mark raises the status of the ast nodes of the pattern, where Failed overrides Matched, which overrides Reached.
+func (r *Result) mark(p *pattern, s Status) {
+	for _, n := range p.origins {
+		if r.statuses[n] < s {
+			r.statuses[n] = s
+		}
+	}
+}
+
+// reach marks the conditional patterns which were tried against the fields of the level as reached,
+// or as matched if their condition held and their children matched.
+func (r *Result) reach(ps *patterns, l *level) {
+	for _, f := range l.fields {
+		for k, e := range f.ifs {
+			s := Reached
+			if f.holds[k] && ps.nullable(f.children.end[k]) {
+				s = Matched
+			}
+			r.mark(e.cond, s)
+		}
+		r.reach(ps, f.children)
+	}
+}
+
+// explain marks the conditional patterns which caused the i'th pattern of the level to fail as failed.
+func (r *Result) explain(ps *patterns, l *level, i int) error {
+	for _, f := range l.fields {
+		if f.after[i].kind != none {
+			continue
+		}
+		// the pattern stopped matching at this field, which is explained by the conditional patterns which did not match,
+		// and by none if they all matched, such as inside a Not, since then the failure is not caused by a single node
+		for k, e := range f.ifs {
+			if f.owners[k] != i {
+				continue
+			}
+			switch {
+			case !f.holds[k]:
+				r.mark(e.cond, Failed)
+			case !ps.nullable(f.children.end[k]):
+				r.mark(e.cond, Failed)
+				if err := r.explain(ps, f.children, k); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	ifs, err := ps.deriveCall([]*pattern{l.end[i]})
+	if err != nil {
+		return err
+	}
+	for _, e := range ifs {
+		r.mark(e.cond, Failed)
+	}
+	return nil
+}
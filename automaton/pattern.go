@@ -0,0 +1,437 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package automaton
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/katydid/katydid/relapse/ast"
+)
+
+type kind int
+
+const (
+	empty kind = iota
+	zany
+	none
+	node
+	leaf
+	concat
+	or
+	and
+	interleave
+	zeroOrMore
+	not
+	reference
+)
+
+// pattern is an interned and simplified relapse pattern,
+// so that equal patterns are the same pointer and states can be compared by their patterns.
+type pattern struct {
+	kind kind
+	// cond is the relapse source of the name of a node or the expression of a leaf.
+	cond string
+	// name is the name of the node if it is a literal name, which makes it exclusive with other literal names.
+	name string
+	// anyName is set if the node matches any name.
+	anyName bool
+	// ref is the name of the referenced pattern.
+	ref      string
+	children []*pattern
+	key      string
+
+	// nameExpr and expr are the name of a node and the expression of a leaf,
+	// which are evaluated when tracing an input.
+	nameExpr *ast.NameExpr
+	expr     *ast.Expr
+	// origins are the TreeNode and LeafNode ast nodes which were converted to the node or leaf pattern.
+	origins []interface{}
+}
+
+func (p *pattern) String() string {
+	return p.key
+}
+
+// patterns interns patterns.
+type patterns struct {
+	interned map[string]*pattern
+	refs     map[string]*pattern
+	nullRefs map[string]bool
+}
+
+func newPatterns() *patterns {
+	return &patterns{
+		interned: make(map[string]*pattern),
+		refs:     make(map[string]*pattern),
+		nullRefs: make(map[string]bool),
+	}
+}
+
+func (ps *patterns) intern(p *pattern) *pattern {
+	p.key = p.format()
+	if q, ok := ps.interned[p.key]; ok {
+		return q
+	}
+	ps.interned[p.key] = p
+	return p
+}
+
+// format returns the relapse syntax of the pattern.
+func (p *pattern) format() string {
+	cs := make([]string, len(p.children))
+	for i, c := range p.children {
+		cs[i] = c.key
+	}
+	switch p.kind {
+	case empty:
+		return "<empty>"
+	case zany:
+		return "*"
+	case none:
+		return "!(*)"
+	case node:
+		return p.cond + ":" + cs[0]
+	case leaf:
+		return "->" + p.cond
+	case concat:
+		return "[" + strings.Join(cs, ", ") + "]"
+	case or:
+		return "(" + strings.Join(cs, " | ") + ")"
+	case and:
+		return "(" + strings.Join(cs, " & ") + ")"
+	case interleave:
+		return "{" + strings.Join(cs, "; ") + "}"
+	case zeroOrMore:
+		return "(" + cs[0] + ")*"
+	case not:
+		return "!(" + cs[0] + ")"
+	case reference:
+		return "@" + p.ref
+	}
+	panic(fmt.Sprintf("unknown pattern kind %d", p.kind))
+}
+
+func (ps *patterns) empty() *pattern { return ps.intern(&pattern{kind: empty}) }
+func (ps *patterns) zany() *pattern  { return ps.intern(&pattern{kind: zany}) }
+func (ps *patterns) none() *pattern  { return ps.intern(&pattern{kind: none}) }
+
+func (ps *patterns) reference(name string) *pattern {
+	return ps.intern(&pattern{kind: reference, ref: name})
+}
+
+func (ps *patterns) node(name *ast.NameExpr, child *pattern) *pattern {
+	p := &pattern{kind: node, cond: source(name), children: []*pattern{child}, nameExpr: name}
+	if name.AnyName != nil {
+		p.anyName = true
+	} else if name.Name != nil {
+		p.name = p.cond
+	}
+	return ps.intern(p)
+}
+
+func (ps *patterns) leaf(expr *ast.Expr) *pattern {
+	return ps.intern(&pattern{kind: leaf, cond: source(expr), expr: expr})
+}
+
+func (ps *patterns) concat(a, b *pattern) *pattern {
+	switch {
+	case a.kind == none || b.kind == none:
+		return ps.none()
+	case a.kind == empty:
+		return b
+	case b.kind == empty:
+		return a
+	case a.kind == zany && b.kind == zany:
+		return a
+	case a.kind == concat:
+		// keep concatenations right associative
+		return ps.concat(a.children[0], ps.concat(a.children[1], b))
+	}
+	return ps.intern(&pattern{kind: concat, children: []*pattern{a, b}})
+}
+
+func (ps *patterns) or(cs ...*pattern) *pattern {
+	cs = flatten(or, cs)
+	var keep []*pattern
+	for _, c := range cs {
+		switch c.kind {
+		case zany:
+			return c
+		case none:
+			continue
+		}
+		keep = append(keep, c)
+	}
+	return ps.set(or, keep, ps.none())
+}
+
+func (ps *patterns) and(cs ...*pattern) *pattern {
+	cs = flatten(and, cs)
+	var keep []*pattern
+	for _, c := range cs {
+		switch c.kind {
+		case none:
+			return c
+		case zany:
+			continue
+		}
+		keep = append(keep, c)
+	}
+	return ps.set(and, keep, ps.zany())
+}
+
+func (ps *patterns) interleave(cs ...*pattern) *pattern {
+	cs = flatten(interleave, cs)
+	var keep []*pattern
+	for _, c := range cs {
+		switch c.kind {
+		case none:
+			return c
+		case empty:
+			continue
+		}
+		keep = append(keep, c)
+	}
+	// interleaving several ZAny is the same as a single ZAny
+	sort.Slice(keep, func(i, j int) bool { return keep[i].key < keep[j].key })
+	var uniq []*pattern
+	for i, c := range keep {
+		if c.kind == zany && i > 0 && keep[i-1] == c {
+			continue
+		}
+		uniq = append(uniq, c)
+	}
+	switch len(uniq) {
+	case 0:
+		return ps.empty()
+	case 1:
+		return uniq[0]
+	}
+	return ps.intern(&pattern{kind: interleave, children: uniq})
+}
+
+// set returns the commutative and idempotent operator over the sorted and deduplicated children.
+func (ps *patterns) set(k kind, cs []*pattern, zero *pattern) *pattern {
+	sort.Slice(cs, func(i, j int) bool { return cs[i].key < cs[j].key })
+	var uniq []*pattern
+	for i, c := range cs {
+		if i > 0 && cs[i-1] == c {
+			continue
+		}
+		uniq = append(uniq, c)
+	}
+	switch len(uniq) {
+	case 0:
+		return zero
+	case 1:
+		return uniq[0]
+	}
+	return ps.intern(&pattern{kind: k, children: uniq})
+}
+
+func flatten(k kind, cs []*pattern) []*pattern {
+	var flat []*pattern
+	for _, c := range cs {
+		if c.kind == k {
+			flat = append(flat, c.children...)
+			continue
+		}
+		flat = append(flat, c)
+	}
+	return flat
+}
+
+func (ps *patterns) zeroOrMore(p *pattern) *pattern {
+	switch p.kind {
+	case zeroOrMore:
+		return p
+	case empty, none:
+		return ps.empty()
+	case zany:
+		return p
+	}
+	return ps.intern(&pattern{kind: zeroOrMore, children: []*pattern{p}})
+}
+
+func (ps *patterns) not(p *pattern) *pattern {
+	switch p.kind {
+	case not:
+		return p.children[0]
+	case zany:
+		return ps.none()
+	case none:
+		return ps.zany()
+	}
+	return ps.intern(&pattern{kind: not, children: []*pattern{p}})
+}
+
+// nullable returns whether the pattern matches an empty list of fields.
+func (ps *patterns) nullable(p *pattern) bool {
+	switch p.kind {
+	case empty, zany, zeroOrMore:
+		return true
+	case none, node, leaf:
+		return false
+	case concat, and, interleave:
+		for _, c := range p.children {
+			if !ps.nullable(c) {
+				return false
+			}
+		}
+		return true
+	case or:
+		for _, c := range p.children {
+			if ps.nullable(c) {
+				return true
+			}
+		}
+		return false
+	case not:
+		return !ps.nullable(p.children[0])
+	case reference:
+		return ps.nullRefs[p.ref]
+	}
+	panic(fmt.Sprintf("unknown pattern kind %d", p.kind))
+}
+
+// resolveNullable computes the nullability of the referenced patterns,
+// starting from not nullable and iterating until it is stable.
+func (ps *patterns) resolveNullable() {
+	for changed := true; changed; {
+		changed = false
+		for name, p := range ps.refs {
+			if n := ps.nullable(p); n != ps.nullRefs[name] {
+				ps.nullRefs[name] = n
+				changed = true
+			}
+		}
+	}
+}
+
+// convert converts the ast pattern to an interned pattern.
+func (ps *patterns) convert(p *ast.Pattern) (*pattern, error) {
+	switch {
+	case p == nil:
+		return nil, fmt.Errorf("missing pattern")
+	case p.Empty != nil:
+		return ps.empty(), nil
+	case p.ZAny != nil:
+		return ps.zany(), nil
+	case p.TreeNode != nil:
+		child, err := ps.convert(p.TreeNode.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		n := ps.node(p.TreeNode.Name, child)
+		n.origins = append(n.origins, p.TreeNode)
+		return n, nil
+	case p.LeafNode != nil:
+		l := ps.leaf(p.LeafNode.Expr)
+		l.origins = append(l.origins, p.LeafNode)
+		return l, nil
+	case p.Concat != nil:
+		return ps.binary(p.Concat.LeftPattern, p.Concat.RightPattern, ps.concat)
+	case p.Or != nil:
+		return ps.binary(p.Or.LeftPattern, p.Or.RightPattern, func(a, b *pattern) *pattern { return ps.or(a, b) })
+	case p.And != nil:
+		return ps.binary(p.And.LeftPattern, p.And.RightPattern, func(a, b *pattern) *pattern { return ps.and(a, b) })
+	case p.Interleave != nil:
+		return ps.binary(p.Interleave.LeftPattern, p.Interleave.RightPattern, func(a, b *pattern) *pattern { return ps.interleave(a, b) })
+	case p.ZeroOrMore != nil:
+		child, err := ps.convert(p.ZeroOrMore.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		return ps.zeroOrMore(child), nil
+	case p.Optional != nil:
+		child, err := ps.convert(p.Optional.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		return ps.or(ps.empty(), child), nil
+	case p.Not != nil:
+		child, err := ps.convert(p.Not.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		return ps.not(child), nil
+	case p.Contains != nil:
+		child, err := ps.convert(p.Contains.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		return ps.concat(ps.zany(), ps.concat(child, ps.zany())), nil
+	case p.Reference != nil:
+		return ps.reference(p.Reference.Name), nil
+	}
+	return nil, fmt.Errorf("unknown pattern %v", p)
+}
+
+func (ps *patterns) binary(left, right *ast.Pattern, op func(a, b *pattern) *pattern) (*pattern, error) {
+	a, err := ps.convert(left)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ps.convert(right)
+	if err != nil {
+		return nil, err
+	}
+	return op(a, b), nil
+}
+
+// ast returns the pattern as an ast pattern, where the operands of Or, And and Interleave are nested to the right
+// and a pattern which matches nothing is !(*).
+func (p *pattern) ast() *ast.Pattern {
+	switch p.kind {
+	case empty:
+		return ast.NewEmpty()
+	case zany:
+		return ast.NewZAny()
+	case none:
+		return ast.NewNot(ast.NewZAny())
+	case node:
+		return ast.NewTreeNode(p.nameExpr, p.children[0].ast())
+	case leaf:
+		return ast.NewLeafNode(p.expr)
+	case concat:
+		return ast.NewConcat(p.children[0].ast(), p.children[1].ast())
+	case or, and, interleave:
+		op := ast.NewOr
+		if p.kind == and {
+			op = ast.NewAnd
+		} else if p.kind == interleave {
+			op = ast.NewInterleave
+		}
+		right := p.children[len(p.children)-1].ast()
+		for i := len(p.children) - 2; i >= 0; i-- {
+			right = op(p.children[i].ast(), right)
+		}
+		return right
+	case zeroOrMore:
+		return ast.NewZeroOrMore(p.children[0].ast())
+	case not:
+		return ast.NewNot(p.children[0].ast())
+	case reference:
+		return ast.NewReference(p.ref)
+	}
+	panic(fmt.Sprintf("unknown pattern kind %d", p.kind))
+}
+
+// source returns the relapse source of the node without the surrounding whitespace.
+func source(node interface{ String() string }) string {
+	return strings.TrimSpace(node.String())
+}
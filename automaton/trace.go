@@ -0,0 +1,244 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package automaton
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/katydid/katydid/parser"
+	"github.com/katydid/katydid/relapse/ast"
+	"github.com/katydid/katydid/relapse/compose"
+	"github.com/katydid/katydid/relapse/nameexpr"
+)
+
+// Step is the derivatives of the grammar after a single event of the tree walk over an input.
+// The derivatives are those of this package, which approximate katydid's validation, instead of being its steps.
+type Step struct {
+	// Event describes the event, which is start or a field which is entered or left, such as enter "A".
+	Event string
+	// Path holds the labels of the fields which are entered, from the top level down.
+	Path []string
+	// Patterns holds the patterns which the fields at each depth are matched against,
+	// from the single top level pattern down to the patterns of the children of the last entered field.
+	Patterns [][]*ast.Pattern
+	// Nullable holds whether each of the Patterns matches an empty list of fields.
+	Nullable [][]bool
+}
+
+// Valid returns whether the top level pattern is nullable,
+// which means the input is valid if the step is its last.
+func (s *Step) Valid() bool {
+	return s.Nullable[0][0]
+}
+
+// Trace validates the input against the grammar, starting from its TopPattern or else the pattern declaration named main,
+// evaluating the conditions of the derivatives on the labels of the input,
+// and returns the derivatives at the start and after every field which is entered or left.
+// The input is validated with katydid's mem package as well, where a *MismatchError is returned if the two disagree.
+func Trace(g *ast.Grammar, p Parser) ([]*Step, error) {
+	ps, err := load(g)
+	if err != nil {
+		return nil, err
+	}
+	katydid, err := validateWithKatydid(g, p)
+	if err != nil {
+		return nil, err
+	}
+	t := newTracer(ps)
+	t.trace = true
+	t.step("start")
+	if err := t.walk(p, &level{}); err != nil {
+		return nil, err
+	}
+	if valid := t.steps[len(t.steps)-1].Valid(); valid != katydid {
+		return nil, &MismatchError{Valid: valid, Katydid: katydid}
+	}
+	return t.steps, nil
+}
+
+// tracer walks an input, deriving the patterns for every field.
+type tracer struct {
+	patterns *patterns
+	funcs    map[*pattern]compose.Bool
+	path     []string
+	// stack holds the patterns at every depth, where the last are the patterns of the current depth.
+	stack [][]*pattern
+	// trace records a step for every event.
+	trace bool
+	steps []*Step
+}
+
+// level records the fields at a single depth.
+type level struct {
+	fields []*field
+	// end holds the patterns after the last field.
+	end []*pattern
+}
+
+// field records how the patterns were derived for a single field.
+type field struct {
+	before []*pattern
+	after  []*pattern
+	// ifs are the conditional patterns of before, where owners holds the index of the pattern in before
+	// which each of the conditional patterns belongs to and holds whether its condition held for the label.
+	ifs      []ifExpr
+	owners   []int
+	holds    []bool
+	children *level
+}
+
+func newTracer(ps *patterns) *tracer {
+	return &tracer{
+		patterns: ps,
+		funcs:    make(map[*pattern]compose.Bool),
+		stack:    [][]*pattern{{ps.refs["main"]}},
+	}
+}
+
+// walk walks the fields at the current depth, deriving the patterns of the current depth for every field,
+// and records them in the level.
+func (t *tracer) walk(p parser.Interface, l *level) error {
+	for {
+		if err := p.Next(); err != nil {
+			if err == io.EOF {
+				l.end = t.stack[len(t.stack)-1]
+				return nil
+			}
+			return err
+		}
+		f := &field{before: t.stack[len(t.stack)-1], children: &level{}}
+		for i, in := range f.before {
+			ifs, err := t.patterns.deriveCall([]*pattern{in})
+			if err != nil {
+				return err
+			}
+			for _, e := range ifs {
+				f.ifs = append(f.ifs, e)
+				f.owners = append(f.owners, i)
+			}
+		}
+		children := make([]*pattern, len(f.ifs))
+		for i, e := range f.ifs {
+			holds, err := t.holds(e.cond, p)
+			if err != nil {
+				return err
+			}
+			f.holds = append(f.holds, holds)
+			children[i] = e.els
+			if holds {
+				children[i] = e.then
+			}
+		}
+		name := label(p)
+		t.path = append(t.path, name)
+		t.stack = append(t.stack, children)
+		t.step("enter " + name)
+		if p.IsLeaf() {
+			f.children.end = children
+		} else {
+			p.Down()
+			err := t.walk(p, f.children)
+			p.Up()
+			if err != nil {
+				return err
+			}
+		}
+		end := f.children.end
+		nullable := make([]bool, len(end))
+		for i, c := range end {
+			nullable[i] = t.patterns.nullable(c)
+		}
+		t.stack = t.stack[:len(t.stack)-1]
+		f.after = t.patterns.deriveReturn(f.before, nullable)
+		t.stack[len(t.stack)-1] = f.after
+		l.fields = append(l.fields, f)
+		t.path = t.path[:len(t.path)-1]
+		t.step("leave " + name)
+	}
+}
+
+// holds evaluates the name or value condition of the pattern on the label of the current field,
+// where a condition which fails to evaluate, such as a string function on an integer value, does not hold.
+func (t *tracer) holds(cond *pattern, v parser.Value) (bool, error) {
+	if cond.anyName {
+		return true, nil
+	}
+	f, ok := t.funcs[cond]
+	if !ok {
+		var err error
+		if f, err = newCondition(cond); err != nil {
+			return false, fmt.Errorf("%s: %v", cond.cond, err)
+		}
+		t.funcs[cond] = f
+	}
+	holds, err := f.Eval(v)
+	return err == nil && holds, nil
+}
+
+// newCondition composes the name of a node or the expression of a leaf into a function of the label.
+func newCondition(cond *pattern) (compose.Bool, error) {
+	if cond.kind == node {
+		return compose.NewBoolFunc(nameexpr.NameToFunc(cond.nameExpr))
+	}
+	b, err := compose.NewBool(cond.expr)
+	if err != nil {
+		return nil, err
+	}
+	return compose.NewBoolFunc(b)
+}
+
+// step records the patterns of the stack, if the tracer traces.
+func (t *tracer) step(event string) {
+	if !t.trace {
+		return
+	}
+	s := &Step{Event: event, Path: append([]string(nil), t.path...)}
+	for _, ps := range t.stack {
+		patterns := make([]*ast.Pattern, len(ps))
+		nullable := make([]bool, len(ps))
+		for i, p := range ps {
+			patterns[i] = p.ast()
+			nullable[i] = t.patterns.nullable(p)
+		}
+		s.Patterns = append(s.Patterns, patterns)
+		s.Nullable = append(s.Nullable, nullable)
+	}
+	t.steps = append(t.steps, s)
+}
+
+// label returns the label of the current field, where strings are quoted.
+func label(v parser.Value) string {
+	if s, err := v.String(); err == nil {
+		return strconv.Quote(s)
+	}
+	if i, err := v.Int(); err == nil {
+		return strconv.FormatInt(i, 10)
+	}
+	if u, err := v.Uint(); err == nil {
+		return strconv.FormatUint(u, 10)
+	}
+	if f, err := v.Double(); err == nil {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	if b, err := v.Bool(); err == nil {
+		return strconv.FormatBool(b)
+	}
+	if bs, err := v.Bytes(); err == nil {
+		return fmt.Sprintf("%q", bs)
+	}
+	return "?"
+}
@@ -0,0 +1,62 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package automaton
+
+import (
+	"fmt"
+
+	"github.com/katydid/katydid/parser"
+	"github.com/katydid/katydid/relapse/ast"
+	"github.com/katydid/katydid/relapse/mem"
+)
+
+// Parser is a parser which can be reset to walk the input again, such as katydid's json parser,
+// since Trace and Match validate the input with katydid before they walk it with the derivatives.
+type Parser interface {
+	parser.Interface
+	Reset() error
+}
+
+// MismatchError is returned by Trace and Match when the derivatives and katydid disagree on whether the input is valid,
+// in which case the derivatives cannot explain katydid's validation.
+type MismatchError struct {
+	// Valid is whether the derivatives validate the input and Katydid whether katydid's mem package does.
+	Valid   bool
+	Katydid bool
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("the derivatives validate the input as %s, but katydid as %s", validity(e.Valid), validity(e.Katydid))
+}
+
+func validity(valid bool) string {
+	if valid {
+		return "valid"
+	}
+	return "invalid"
+}
+
+// validateWithKatydid validates the input with katydid's mem package and resets the parser.
+func validateWithKatydid(g *ast.Grammar, p Parser) (bool, error) {
+	m, err := mem.New(g)
+	if err != nil {
+		return false, err
+	}
+	valid, err := m.Validate(p)
+	if err != nil {
+		return false, err
+	}
+	return valid, p.Reset()
+}
@@ -0,0 +1,479 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Command relapseviz visualizes a relapse grammar.
+//
+// Usage:
+//
+//	relapseviz [flags] [file.relapse]
+//
+// The grammar is read from the file or, when no file is given, from stdin.
+// The graph is written to stdout or to the file given by -o,
+// in the format given by -format or else by the extension of the -o file.
+//
+// With -match, the input is validated against the grammar and the nodes are colored by how they took part,
+// as approximated by relapseviz's derivatives.
+// With -trace, the input is validated against the grammar and a graph of the derivatives
+// is written after every field which is entered or left, where the derivatives are relapseviz's own,
+// which approximate katydid's validation, either as a single html page with a slider,
+// or as numbered files next to the -o file, such as trace-000.svg, trace-001.svg, ...
+// The input is json, xml or, with -protodesc and -protomsg, a protobuf message, as given by -input.
+// With -diff, the grammar is compared to an older revision of it and both are drawn as a single graph,
+// where a summary of the changes is written to stderr.
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/awalterschulze/gographviz"
+	gogoproto "github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	"github.com/jmarais/relapseviz"
+	relapseautomaton "github.com/jmarais/relapseviz/automaton"
+	"github.com/jmarais/relapseviz/railroad"
+	"github.com/jmarais/relapseviz/svg"
+	"github.com/katydid/katydid/parser/json"
+	"github.com/katydid/katydid/parser/proto"
+	"github.com/katydid/katydid/parser/xml"
+	"github.com/katydid/katydid/relapse"
+	"github.com/katydid/katydid/relapse/ast"
+	relapseerrors "github.com/katydid/katydid/relapse/errors"
+)
+
+// command holds the flags and the standard streams of a single run of relapseviz.
+type command struct {
+	output     string
+	format     string
+	full       bool
+	compact    bool
+	references bool
+	clusters   bool
+	htmlLabels bool
+	focus      string
+	focusDepth int
+	maxDepth   int
+	sources    bool
+	sourceURL  string
+	theme      string
+	rankdir    string
+	dot        bool
+	graphviz   string
+	engine     string
+	dpi        float64
+	size       string
+	trace      string
+	match      string
+	input      string
+	protoDesc  string
+	protoMsg   string
+	diff       string
+
+	graphvizGraphAttrs attrFlag
+	graphvizNodeAttrs  attrFlag
+	graphvizEdgeAttrs  attrFlag
+
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// flagSet returns the flags of relapseviz, which are parsed into the command.
+func (c *command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("relapseviz", flag.ContinueOnError)
+	fs.StringVar(&c.output, "o", "", "output file, stdout if empty")
+	fs.StringVar(&c.format, "format", "", "output format: dot, svg, html, png, pdf, eps, json, mermaid or railroad, guessed from the -o extension and dot if empty, where png, pdf, eps and json are written by Graphviz")
+	fs.BoolVar(&c.full, "full", false, "also traverse the keyword and space nodes")
+	fs.BoolVar(&c.compact, "compact", false, "translate to the compact view, which mirrors the relapse syntax")
+	fs.BoolVar(&c.references, "references", false, "add edges from references to their pattern declarations")
+	fs.BoolVar(&c.clusters, "clusters", false, "draw every pattern declaration inside its own cluster")
+	fs.BoolVar(&c.htmlLabels, "htmllabels", false, "draw the labels as tables with a row per field, where the edges to the children leave from the row of their field")
+	fs.StringVar(&c.focus, "focus", "", "only translate the pattern declaration with this name, or main for the top pattern")
+	fs.IntVar(&c.focusDepth, "focusdepth", 0, "also translate the pattern declarations which -focus references, up to this many references away, or all if negative")
+	fs.IntVar(&c.maxDepth, "maxdepth", 0, "collapse the subtrees below this depth into a single node, draw every node if zero")
+	fs.BoolVar(&c.sources, "sources", false, "add the relapse source of every node, with its line and column, as its tooltip")
+	fs.StringVar(&c.sourceURL, "sourceurl", "", "URL of the relapse file, to which every node links with the fragment of its lines, with -sources")
+	fs.StringVar(&c.theme, "theme", "", "style the nodes by their kind with the light, dark or print theme, or with a theme from a json file")
+	fs.StringVar(&c.rankdir, "rankdir", "", "graphviz rankdir, for example LR")
+	fs.BoolVar(&c.dot, "dot", false, "lay out svg with the Graphviz dot binary instead of the built-in layout")
+	fs.StringVar(&c.graphviz, "graphviz", "", "path of the Graphviz binary, which implies -dot, $GRAPHVIZ_DOT or dot if empty")
+	fs.StringVar(&c.engine, "engine", "", "Graphviz layout engine, such as dot, neato, fdp, sfdp, twopi or circo, which implies -dot")
+	fs.Float64Var(&c.dpi, "dpi", 0, "resolution in pixels per inch of the output written by Graphviz, such as png, 96 if zero")
+	fs.StringVar(&c.size, "size", "", "maximum size in inches of the output written by Graphviz, such as 7.5,10, where a trailing ! also scales smaller graphs up")
+	fs.StringVar(&c.trace, "trace", "", "input to validate against the grammar, writing relapseviz's derivatives, an approximation of katydid's validation, after every field as html or numbered -o files")
+	fs.StringVar(&c.match, "match", "", "input to validate against the grammar, coloring the matched nodes green, the nodes which caused the failure red and the unreached nodes grey")
+	fs.StringVar(&c.input, "input", "", "format of the -trace and -match input: json, xml or proto, guessed from its .xml or .pb extension or from -protomsg, and json otherwise")
+	fs.StringVar(&c.protoDesc, "protodesc", "", "FileDescriptorSet, as written by protoc --descriptor_set_out, which describes the proto input")
+	fs.StringVar(&c.protoMsg, "protomsg", "", "package.Message of the proto input")
+	fs.StringVar(&c.diff, "diff", "", "older revision of the grammar to compare against, coloring the added nodes green, the removed nodes red and the changed nodes orange")
+	c.graphvizGraphAttrs, c.graphvizNodeAttrs, c.graphvizEdgeAttrs = attrFlag{}, attrFlag{}, attrFlag{}
+	fs.Var(c.graphvizGraphAttrs, "G", "default graph attribute name=value passed to Graphviz with -dot, can be repeated")
+	fs.Var(c.graphvizNodeAttrs, "N", "default node attribute name=value passed to Graphviz with -dot, can be repeated")
+	fs.Var(c.graphvizEdgeAttrs, "E", "default edge attribute name=value passed to Graphviz with -dot, can be repeated")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: relapseviz [flags] [file.relapse]\n")
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// attrFlag collects the name=value attributes of a repeated flag.
+type attrFlag map[string]string
+
+func (a attrFlag) String() string {
+	var ss []string
+	for name, value := range a {
+		ss = append(ss, name+"="+value)
+	}
+	sort.Strings(ss)
+	return strings.Join(ss, " ")
+}
+
+func (a attrFlag) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("expected name=value, but got %q", s)
+	}
+	a[s[:i]] = s[i+1:]
+	return nil
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs relapseviz with the arguments, which exclude the name of the command, and returns its exit code,
+// which is 2 for invalid arguments and 1 if the grammar could not be visualized.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &command{stdin: stdin, stdout: stdout, stderr: stderr}
+	fs := c.flagSet()
+	fs.SetOutput(stderr)
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+	if err := c.run(fs.Arg(0)); err != nil {
+		fmt.Fprintf(stderr, "relapseviz: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func (c *command) run(filename string) error {
+	src, err := c.read(filename)
+	if err != nil {
+		return err
+	}
+	g, err := relapse.Parse(string(src))
+	if err != nil {
+		return syntaxError(filename, err)
+	}
+	if c.trace != "" {
+		return c.runTrace(g)
+	}
+	if c.diff != "" {
+		return c.runDiff(g)
+	}
+	buf := new(bytes.Buffer)
+	if c.outputFormat() == "railroad" {
+		if g, err = c.focusGrammar(g); err != nil {
+			return err
+		}
+		if err := railroad.WriteSVG(g, buf); err != nil {
+			return err
+		}
+		return c.flush(buf)
+	}
+	opts, err := c.options()
+	if err != nil {
+		return err
+	}
+	if c.match != "" {
+		p, err := c.parser(c.match)
+		if err != nil {
+			return err
+		}
+		if opts.Match, err = relapseautomaton.Match(g, p); err != nil {
+			return err
+		}
+	}
+	graph, err := relapseviz.TranslateGrammar(g, opts)
+	if err != nil {
+		return err
+	}
+	if err := c.write(graph, c.outputFormat(), buf); err != nil {
+		return err
+	}
+	return c.flush(buf)
+}
+
+func (c *command) options() (relapseviz.Options, error) {
+	opts := relapseviz.Options{
+		Keywords:   c.full,
+		Spaces:     c.full,
+		Compact:    c.compact,
+		References: c.references,
+		Clusters:   c.clusters,
+		HTMLLabels: c.htmlLabels,
+		Focus:      c.focus,
+		FocusDepth: c.focusDepth,
+		MaxDepth:   c.maxDepth,
+		Sources:    c.sources || c.outputFormat() == "html",
+		SourceURL:  c.sourceURL,
+		RankDir:    c.rankdir,
+		Layout:     c.engine,
+	}
+	if c.theme != "" {
+		t, err := relapseviz.LoadTheme(c.theme)
+		if err != nil {
+			return opts, err
+		}
+		opts.Theme = t
+	}
+	return opts, nil
+}
+
+// runTrace validates the -trace input against the grammar
+// and writes the frames as html or as a numbered file for every frame.
+func (c *command) runTrace(g *ast.Grammar) error {
+	g, err := c.focusGrammar(g)
+	if err != nil {
+		return err
+	}
+	p, err := c.parser(c.trace)
+	if err != nil {
+		return err
+	}
+	opts, err := c.options()
+	if err != nil {
+		return err
+	}
+	frames, err := relapseviz.TranslateTrace(g, p, opts)
+	if err != nil {
+		return err
+	}
+	if c.outputFormat() == "html" {
+		buf := new(bytes.Buffer)
+		if err := c.renderer().WriteTraceHTML(frames, buf); err != nil {
+			return err
+		}
+		return c.flush(buf)
+	}
+	if c.output == "" {
+		return fmt.Errorf("-trace writes a file for every frame, which requires -o, unless the format is html")
+	}
+	ext := filepath.Ext(c.output)
+	base := strings.TrimSuffix(c.output, ext)
+	if ext == "" {
+		ext = "." + c.outputFormat()
+	}
+	for i, f := range frames {
+		buf := new(bytes.Buffer)
+		if err := c.write(f.Graph, c.outputFormat(), buf); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(fmt.Sprintf("%s-%03d%s", base, i, ext), buf.Bytes(), 0666); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runDiff compares the grammar to the -diff grammar, writing the merged graph to the output and the changes to stderr.
+func (c *command) runDiff(g *ast.Grammar) error {
+	src, err := c.read(c.diff)
+	if err != nil {
+		return err
+	}
+	old, err := relapse.Parse(string(src))
+	if err != nil {
+		return syntaxError(c.diff, err)
+	}
+	opts, err := c.options()
+	if err != nil {
+		return err
+	}
+	graph, changes, err := relapseviz.Diff(old, g, opts)
+	if err != nil {
+		return err
+	}
+	buf := new(bytes.Buffer)
+	if err := c.write(graph, c.outputFormat(), buf); err != nil {
+		return err
+	}
+	for _, change := range changes {
+		fmt.Fprintln(c.stderr, change)
+	}
+	return c.flush(buf)
+}
+
+// parser returns a parser of the -trace or -match input file in the -input format.
+func (c *command) parser(filename string) (relapseautomaton.Parser, error) {
+	input, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var p interface {
+		relapseautomaton.Parser
+		Init([]byte) error
+	}
+	switch format := c.inputFormat(filename); format {
+	case "json":
+		p = json.NewJsonParser()
+	case "xml":
+		p = xml.NewXMLParser()
+	case "proto":
+		if p, err = c.protoParser(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown input format %q, expected json, xml or proto", format)
+	}
+	if err := p.Init(input); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return p, nil
+}
+
+func (c *command) inputFormat(filename string) string {
+	if c.input != "" {
+		return c.input
+	}
+	if c.protoMsg != "" {
+		return "proto"
+	}
+	switch filepath.Ext(filename) {
+	case ".xml":
+		return "xml"
+	case ".pb":
+		return "proto"
+	}
+	return "json"
+}
+
+// protoParser returns a parser of the -protomsg message, which is described by the -protodesc FileDescriptorSet.
+func (c *command) protoParser() (proto.ProtoParser, error) {
+	if c.protoDesc == "" || c.protoMsg == "" {
+		return nil, fmt.Errorf("proto input requires -protodesc and -protomsg")
+	}
+	data, err := ioutil.ReadFile(c.protoDesc)
+	if err != nil {
+		return nil, err
+	}
+	desc := &descriptor.FileDescriptorSet{}
+	if err := gogoproto.Unmarshal(data, desc); err != nil {
+		return nil, fmt.Errorf("%s: %v", c.protoDesc, err)
+	}
+	i := strings.LastIndex(c.protoMsg, ".")
+	if i <= 0 {
+		return nil, fmt.Errorf("expected -protomsg as package.Message, but got %q", c.protoMsg)
+	}
+	return proto.NewProtoParser(c.protoMsg[:i], c.protoMsg[i+1:], desc)
+}
+
+// flush writes the buffer to stdout or to the -o file.
+func (c *command) flush(buf *bytes.Buffer) error {
+	if c.output == "" {
+		_, err := io.Copy(c.stdout, buf)
+		return err
+	}
+	return ioutil.WriteFile(c.output, buf.Bytes(), 0666)
+}
+
+func (c *command) read(filename string) ([]byte, error) {
+	if filename == "" || filename == "-" {
+		return ioutil.ReadAll(c.stdin)
+	}
+	return ioutil.ReadFile(filename)
+}
+
+// syntaxError prefixes the parse error with the position at which it occurred.
+func syntaxError(filename string, err error) error {
+	if filename == "" {
+		filename = "<stdin>"
+	}
+	perr, ok := err.(*relapseerrors.Error)
+	if !ok || perr.ErrorToken == nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	pos := perr.ErrorToken.Pos
+	return fmt.Errorf("%s:%d:%d: syntax error near %q: %v", filename, pos.Line, pos.Column, perr.ErrorToken.Lit, err)
+}
+
+// focusGrammar returns the grammar focused on the -focus pattern declaration,
+// for the outputs which are not translated with the focus option.
+func (c *command) focusGrammar(g *ast.Grammar) (*ast.Grammar, error) {
+	if c.focus == "" {
+		return g, nil
+	}
+	return relapseviz.Focus(g, c.focus, c.focusDepth)
+}
+
+func (c *command) outputFormat() string {
+	if c.format != "" {
+		return c.format
+	}
+	if ext := strings.TrimPrefix(filepath.Ext(c.output), "."); ext != "" {
+		return ext
+	}
+	return "dot"
+}
+
+// renderer returns the renderer which lays out the graphs with the Graphviz binary, if -dot or a Graphviz flag is given,
+// or else with the built-in layout.
+func (c *command) renderer() relapseviz.Renderer {
+	return relapseviz.Renderer{
+		BuiltinLayout: !(c.dot || c.graphviz != "" || c.engine != ""),
+		Graphviz: svg.Graphviz{
+			Path:       c.graphviz,
+			GraphAttrs: c.graphvizGraphAttrs,
+			NodeAttrs:  c.graphvizNodeAttrs,
+			EdgeAttrs:  c.graphvizEdgeAttrs,
+			Stderr:     c.stderr,
+		},
+		DPI:  c.dpi,
+		Size: c.size,
+	}
+}
+
+func (c *command) write(graph *gographviz.Graph, format string, w io.Writer) error {
+	switch format {
+	case "dot", "gv":
+		_, err := io.WriteString(w, graph.String())
+		return err
+	case "svg":
+		return c.renderer().WriteSVG(graph, w)
+	case "html":
+		return c.renderer().WriteHTML(graph, w)
+	case "png", "pdf", "eps", "json":
+		return c.renderer().WriteFormat(context.Background(), format, graph, w)
+	case "mermaid", "mmd":
+		return relapseviz.WriteMermaid(graph, w)
+	}
+	return fmt.Errorf("unknown output format %q", format)
+}
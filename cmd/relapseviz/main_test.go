@@ -0,0 +1,127 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunStdin(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if code := run(nil, strings.NewReader(`.A == "a"`), stdout, stderr); code != 0 {
+		t.Fatalf("expected exit code 0, but got %d: %s", code, stderr)
+	}
+	if !strings.HasPrefix(stdout.String(), "digraph") {
+		t.Fatalf("expected a dot graph, but got %q", stdout)
+	}
+	if !strings.Contains(stdout.String(), `"a"`) {
+		t.Fatalf("expected the string of the grammar in the graph, but got %q", stdout)
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "relapseviz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "a.relapse")
+	if err := ioutil.WriteFile(filename, []byte(`.A == "a"`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "a.dot")
+	stderr := new(bytes.Buffer)
+	if code := run([]string{"-o", output, filename}, strings.NewReader(""), new(bytes.Buffer), stderr); code != 0 {
+		t.Fatalf("expected exit code 0, but got %d: %s", code, stderr)
+	}
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "digraph") {
+		t.Fatalf("expected a dot graph, but got %q", data)
+	}
+}
+
+func TestRunSyntaxError(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if code := run(nil, strings.NewReader(".A == \"a\" &\n.B == ) "), stdout, stderr); code != 1 {
+		t.Fatalf("expected exit code 1, but got %d: %s", code, stderr)
+	}
+	if !strings.HasPrefix(stderr.String(), "relapseviz: <stdin>:2:") {
+		t.Fatalf("expected the position of the syntax error, but got %q", stderr)
+	}
+	if !strings.Contains(stderr.String(), "syntax error") {
+		t.Fatalf("expected a syntax error, but got %q", stderr)
+	}
+	if stdout.Len() != 0 {
+		t.Fatalf("expected no output, but got %q", stdout)
+	}
+}
+
+func TestRunUsage(t *testing.T) {
+	stderr := new(bytes.Buffer)
+	if code := run([]string{"a.relapse", "b.relapse"}, strings.NewReader(""), new(bytes.Buffer), stderr); code != 2 {
+		t.Fatalf("expected exit code 2 for too many arguments, but got %d", code)
+	}
+	if code := run([]string{"-nosuchflag"}, strings.NewReader(""), new(bytes.Buffer), stderr); code != 2 {
+		t.Fatalf("expected exit code 2 for an unknown flag, but got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "usage: relapseviz") {
+		t.Fatalf("expected the usage, but got %q", stderr)
+	}
+}
+
+func TestRunMatchInput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "relapseviz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	inputs := map[string][]byte{
+		"a.json": []byte(`{"A":"x"}`),
+		"a.xml":  []byte(`<A>x</A>`),
+	}
+	for name, data := range inputs {
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, data, 0666); err != nil {
+			t.Fatal(err)
+		}
+		stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+		if code := run([]string{"-match", filename}, strings.NewReader(`.A == "x"`), stdout, stderr); code != 0 {
+			t.Fatalf("expected exit code 0 for %s, but got %d: %s", name, code, stderr)
+		}
+		if !strings.Contains(stdout.String(), "palegreen") {
+			t.Fatalf("expected the matched nodes to be colored for %s, but got %q", name, stdout)
+		}
+	}
+	// proto input needs the message and its descriptor
+	filename := filepath.Join(dir, "a.pb")
+	if err := ioutil.WriteFile(filename, []byte{0x0a, 0x01, 'x'}, 0666); err != nil {
+		t.Fatal(err)
+	}
+	stderr := new(bytes.Buffer)
+	if code := run([]string{"-match", filename}, strings.NewReader(`.A == "x"`), new(bytes.Buffer), stderr); code != 1 {
+		t.Fatalf("expected exit code 1 without -protodesc, but got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "-protodesc") {
+		t.Fatalf("expected an error about -protodesc, but got %q", stderr)
+	}
+}
@@ -0,0 +1,196 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package relapseviz
+
+import (
+	"strings"
+
+	"github.com/katydid/katydid/relapse/ast"
+)
+
+// compact translates the node into the compact view, where nodes are labelled by their
+// relapse operator, name and leaf expressions are written into the labels and
+// chains of the same binary operator are flattened into a single node.
+// The Pattern wrappers are elided by down.
+func (t *translator) compact(node interface{}, nodeId string) {
+	switch v := node.(type) {
+	case *ast.Grammar:
+		t.addNode(nodeId, map[string]string{attrLabel: quote(getTypeName(v))})
+		t.patterns(nodeId, v)
+	case *ast.PatternDecl:
+		t.decls[v.Name] = nodeId
+		t.addNode(nodeId, map[string]string{attrLabel: quote(`#` + escape(v.Name))})
+		if v.Pattern != nil {
+			t.down(nodeId, v.Pattern, `Pattern`)
+		}
+	case *ast.Pattern:
+		t.addNode(nodeId, map[string]string{attrLabel: quote(getTypeName(v))})
+	case *ast.Empty:
+		t.addNode(nodeId, map[string]string{attrLabel: quote(`<empty>`)})
+	case *ast.TreeNode:
+		t.addNode(nodeId, t.matched(v, map[string]string{attrLabel: quote(source(v.Name) + `:`)}))
+		if v.Pattern != nil {
+			t.down(nodeId, v.Pattern, `Pattern`)
+		}
+	case *ast.Contains:
+		if v.Pattern != nil && v.Pattern.TreeNode != nil {
+			tree := v.Pattern.TreeNode
+			t.kind = getTypeName(tree)
+			t.addNode(nodeId, t.matched(tree, map[string]string{attrLabel: quote(`.` + source(tree.Name) + `:`)}))
+			if tree.Pattern != nil {
+				t.down(nodeId, tree.Pattern, `Pattern.TreeNode.Pattern`)
+			}
+			return
+		}
+		t.addNode(nodeId, map[string]string{attrLabel: quote(`.`)})
+		if v.Pattern != nil {
+			t.down(nodeId, v.Pattern, `Pattern`)
+		}
+	case *ast.LeafNode:
+		t.addNode(nodeId, t.matched(v, map[string]string{attrLabel: quote(source(v.Expr))}))
+	case *ast.Concat:
+		t.addNode(nodeId, map[string]string{attrLabel: quote(`[…]`)})
+		t.operands(nodeId, v, `Concat`)
+	case *ast.Or:
+		t.addNode(nodeId, map[string]string{attrLabel: quote(`|`)})
+		t.operands(nodeId, v, `Or`)
+	case *ast.And:
+		t.addNode(nodeId, map[string]string{attrLabel: quote(`&`)})
+		t.operands(nodeId, v, `And`)
+	case *ast.Interleave:
+		t.addNode(nodeId, map[string]string{attrLabel: quote(`{…}`)})
+		t.operands(nodeId, v, `Interleave`)
+	case *ast.ZeroOrMore:
+		t.addNode(nodeId, map[string]string{attrLabel: quote(`(…)*`)})
+		if v.Pattern != nil {
+			t.down(nodeId, v.Pattern, `Pattern`)
+		}
+	case *ast.Optional:
+		t.addNode(nodeId, map[string]string{attrLabel: quote(`(…)?`)})
+		if v.Pattern != nil {
+			t.down(nodeId, v.Pattern, `Pattern`)
+		}
+	case *ast.Not:
+		t.addNode(nodeId, map[string]string{attrLabel: quote(`!`)})
+		if v.Pattern != nil {
+			t.down(nodeId, v.Pattern, `Pattern`)
+		}
+	case *ast.ZAny:
+		t.addNode(nodeId, map[string]string{attrLabel: quote(`*`)})
+	case *ast.Reference:
+		t.addNode(nodeId, map[string]string{attrLabel: quote(`@` + escape(v.Name))})
+		t.refs = append(t.refs, reference{from: nodeId, decl: t.decl, name: v.Name})
+	default:
+		t.fail(&UnknownNodeError{Path: t.pathString(), Node: v})
+	}
+}
+
+// operands translates the operands of a chain of the same binary operator,
+// such as (a | (b | c)), as children of a single node.
+func (t *translator) operands(nodeId string, op interface{}, opField string) {
+	for _, o := range flatten(op, opField, nil) {
+		t.down(nodeId, o.pattern, strings.Join(o.path, "."))
+	}
+}
+
+// operand is a pattern found at the relative path inside a chain of binary operators.
+type operand struct {
+	pattern *ast.Pattern
+	path    []string
+}
+
+func flatten(op interface{}, opField string, path []string) []operand {
+	var left, right *ast.Pattern
+	switch v := op.(type) {
+	case *ast.Concat:
+		left, right = v.LeftPattern, v.RightPattern
+	case *ast.Or:
+		left, right = v.LeftPattern, v.RightPattern
+	case *ast.And:
+		left, right = v.LeftPattern, v.RightPattern
+	case *ast.Interleave:
+		left, right = v.LeftPattern, v.RightPattern
+	}
+	var os []operand
+	for _, side := range []struct {
+		field   string
+		pattern *ast.Pattern
+	}{{`LeftPattern`, left}, {`RightPattern`, right}} {
+		if side.pattern == nil {
+			continue
+		}
+		p := append(append([]string{}, path...), side.field)
+		if inner := sameOperator(side.pattern, opField); inner != nil {
+			os = append(os, flatten(inner, opField, append(p, opField))...)
+			continue
+		}
+		os = append(os, operand{side.pattern, p})
+	}
+	return os
+}
+
+// sameOperator returns the binary operator of the pattern if it is the same as opField.
+func sameOperator(p *ast.Pattern, opField string) interface{} {
+	switch {
+	case opField == `Concat` && p.Concat != nil:
+		return p.Concat
+	case opField == `Or` && p.Or != nil:
+		return p.Or
+	case opField == `And` && p.And != nil:
+		return p.And
+	case opField == `Interleave` && p.Interleave != nil:
+		return p.Interleave
+	}
+	return nil
+}
+
+// unwrap returns the single child of an ast.Pattern and the name of its field.
+func unwrap(p *ast.Pattern) (interface{}, string) {
+	switch {
+	case p.Empty != nil:
+		return p.Empty, `Empty`
+	case p.TreeNode != nil:
+		return p.TreeNode, `TreeNode`
+	case p.LeafNode != nil:
+		return p.LeafNode, `LeafNode`
+	case p.Concat != nil:
+		return p.Concat, `Concat`
+	case p.Or != nil:
+		return p.Or, `Or`
+	case p.And != nil:
+		return p.And, `And`
+	case p.ZeroOrMore != nil:
+		return p.ZeroOrMore, `ZeroOrMore`
+	case p.Reference != nil:
+		return p.Reference, `Reference`
+	case p.Not != nil:
+		return p.Not, `Not`
+	case p.ZAny != nil:
+		return p.ZAny, `ZAny`
+	case p.Contains != nil:
+		return p.Contains, `Contains`
+	case p.Optional != nil:
+		return p.Optional, `Optional`
+	case p.Interleave != nil:
+		return p.Interleave, `Interleave`
+	}
+	return nil, ""
+}
+
+// source returns the relapse source of the node without the surrounding whitespace,
+// escaped to be used inside a label.
+func source(node interface{ String() string }) string {
+	return escape(strings.TrimSpace(node.String()))
+}
@@ -0,0 +1,278 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package relapseviz
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/awalterschulze/gographviz"
+	"github.com/katydid/katydid/relapse/ast"
+)
+
+// ChangeKind is how a node differs between two grammars.
+type ChangeKind int
+
+const (
+	// Added nodes are only in the new grammar.
+	Added ChangeKind = iota
+	// Removed nodes are only in the old grammar.
+	Removed
+	// Changed nodes are in both grammars, but with a different label.
+	Changed
+)
+
+// diffColors are the fill colors of the nodes for every kind of change.
+var diffColors = map[ChangeKind]string{
+	Added:   "palegreen",
+	Removed: "lightcoral",
+	Changed: "orange",
+}
+
+// Change is a difference between two grammars.
+type Change struct {
+	Kind ChangeKind
+	// Path is the path from the ast.Grammar to the node, with the PatternDecls named, as in NamedPathIDs.
+	Path string
+	// Old and New are the labels of the node in the old and the new grammar,
+	// where Old is empty for added nodes and New is empty for removed nodes.
+	Old string
+	New string
+}
+
+// String returns the change as a line of a summary, for example
+//
+//	~ Grammar.#main.Pattern.TreeNode: TreeNode; Name: A → TreeNode; Name: B
+//
+// where added nodes start with a +, removed nodes with a - and changed nodes with a ~.
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return "+ " + c.Path + ": " + oneLine(c.New)
+	case Removed:
+		return "- " + c.Path + ": " + oneLine(c.Old)
+	}
+	return "~ " + c.Path + ": " + oneLine(c.Old) + " → " + oneLine(c.New)
+}
+
+func oneLine(label string) string {
+	return strings.Replace(label, "\n", "; ", -1)
+}
+
+// Diff translates both grammars with TranslateGrammar and merges them into a single graph, to review a change to a grammar.
+// The nodes are lined up by the name of their PatternDecl and their position below it, as in NamedPathIDs,
+// which is used instead of Options.IDs.
+// Added nodes are green, removed nodes are red and dashed and the nodes of which the label changed are orange,
+// where the edges which were added or removed are colored in the same way.
+// The returned changes summarize the difference, with a change for every changed node
+// and for the top of every added or removed subtree, in the order of the new and then the old graph.
+func Diff(old, new *ast.Grammar, opts Options) (*gographviz.Graph, []Change, error) {
+	opts.IDs = NamedPathIDs
+	before, err := TranslateGrammar(old, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	after, err := TranslateGrammar(new, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	d := &differ{
+		before: before,
+		after:  after,
+		graph:  gographviz.NewGraph(),
+		kinds:  make(map[string]ChangeKind),
+	}
+	if err := d.merge(); err != nil {
+		return nil, nil, &GraphError{Err: err}
+	}
+	return d.graph, d.changes(), nil
+}
+
+type differ struct {
+	before *gographviz.Graph
+	after  *gographviz.Graph
+	graph  *gographviz.Graph
+	// kinds holds the change of every node which was added, removed or changed.
+	kinds map[string]ChangeKind
+}
+
+// merge adds the graph attributes and the subgraphs of the new graph,
+// followed by the nodes and edges of both graphs.
+func (d *differ) merge() error {
+	if err := d.graph.SetName(d.after.Name); err != nil {
+		return err
+	}
+	if err := d.graph.SetDir(true); err != nil {
+		return err
+	}
+	for field, value := range d.after.Attrs {
+		if err := d.graph.AddAttr(d.graph.Name, string(field), value); err != nil {
+			return err
+		}
+	}
+	for _, g := range []*gographviz.Graph{d.after, d.before} {
+		var names []string
+		for name := range g.SubGraphs.SubGraphs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if d.graph.IsSubGraph(name) {
+				continue
+			}
+			if err := d.graph.AddSubGraph(parentOf(g, name), name, attrMap(g.SubGraphs.SubGraphs[name].Attrs)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, n := range d.after.Nodes.Nodes {
+		attrs := attrMap(n.Attrs)
+		if o, ok := d.before.Nodes.Lookup[n.Name]; !ok {
+			d.kinds[n.Name] = Added
+			colorNode(attrs, Added)
+		} else if o.Attrs[gographviz.Label] != n.Attrs[gographviz.Label] {
+			d.kinds[n.Name] = Changed
+			colorNode(attrs, Changed)
+		}
+		if err := d.graph.AddNode(parentOf(d.after, n.Name), n.Name, attrs); err != nil {
+			return err
+		}
+	}
+	for _, n := range d.before.Nodes.Nodes {
+		if _, ok := d.after.Nodes.Lookup[n.Name]; ok {
+			continue
+		}
+		d.kinds[n.Name] = Removed
+		attrs := attrMap(n.Attrs)
+		colorNode(attrs, Removed)
+		if err := d.graph.AddNode(parentOf(d.before, n.Name), n.Name, attrs); err != nil {
+			return err
+		}
+	}
+	for _, e := range d.after.Edges.Edges {
+		attrs := attrMap(e.Attrs)
+		if !hasEdge(d.before, e) {
+			attrs[string(gographviz.Color)] = "green"
+		}
+		if err := d.graph.AddPortEdge(e.Src, e.SrcPort, e.Dst, e.DstPort, true, attrs); err != nil {
+			return err
+		}
+	}
+	for _, e := range d.before.Edges.Edges {
+		if hasEdge(d.after, e) {
+			continue
+		}
+		attrs := attrMap(e.Attrs)
+		attrs[string(gographviz.Color)] = "red"
+		addStyle(attrs, "dashed")
+		if err := d.graph.AddPortEdge(e.Src, e.SrcPort, e.Dst, e.DstPort, true, attrs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changes returns the changed nodes and the nodes at the top of the added and removed subtrees,
+// which are the nodes with an edge from a node which was not added or removed in the same way, or without any edges to them.
+func (d *differ) changes() []Change {
+	var cs []Change
+	add := func(g *gographviz.Graph, n *gographviz.Node) {
+		kind, ok := d.kinds[n.Name]
+		if !ok {
+			return
+		}
+		if kind != Changed && !d.top(g, n.Name, kind) {
+			return
+		}
+		c := Change{Kind: kind, Path: unquoteDot(n.Name)}
+		if o, ok := d.before.Nodes.Lookup[n.Name]; ok {
+			c.Old = labelText(o.Attrs[gographviz.Label])
+		}
+		if o, ok := d.after.Nodes.Lookup[n.Name]; ok {
+			c.New = labelText(o.Attrs[gographviz.Label])
+		}
+		cs = append(cs, c)
+	}
+	for _, n := range d.after.Nodes.Nodes {
+		add(d.after, n)
+	}
+	for _, n := range d.before.Nodes.Nodes {
+		if _, ok := d.after.Nodes.Lookup[n.Name]; !ok {
+			add(d.before, n)
+		}
+	}
+	return cs
+}
+
+// top returns whether the added or removed node is the top of an added or removed subtree.
+func (d *differ) top(g *gographviz.Graph, name string, kind ChangeKind) bool {
+	srcs := g.Edges.DstToSrcs[name]
+	if len(srcs) == 0 {
+		return true
+	}
+	for src := range srcs {
+		if k, ok := d.kinds[src]; !ok || k != kind {
+			return true
+		}
+	}
+	return false
+}
+
+// parentOf returns the graph or subgraph which holds the node or subgraph.
+func parentOf(g *gographviz.Graph, name string) string {
+	for p := range g.Relations.ChildToParents[name] {
+		return p
+	}
+	return g.Name
+}
+
+func hasEdge(g *gographviz.Graph, e *gographviz.Edge) bool {
+	for _, other := range g.Edges.SrcToDsts[e.Src][e.Dst] {
+		if other.SrcPort == e.SrcPort && other.DstPort == e.DstPort {
+			return true
+		}
+	}
+	return false
+}
+
+func attrMap(attrs gographviz.Attrs) map[string]string {
+	m := make(map[string]string, len(attrs))
+	for field, value := range attrs {
+		m[string(field)] = value
+	}
+	return m
+}
+
+// colorNode fills the node with the color of the change, where removed nodes are also dashed.
+func colorNode(attrs map[string]string, kind ChangeKind) {
+	attrs[string(gographviz.FillColor)] = diffColors[kind]
+	addStyle(attrs, "filled")
+	if kind == Removed {
+		addStyle(attrs, "dashed")
+	}
+}
+
+// addStyle adds the style to the styles of the node or edge, unless it is one of them already.
+func addStyle(attrs map[string]string, style string) {
+	if s := unquoteDot(attrs[string(gographviz.Style)]); s != "" {
+		for _, existing := range strings.Split(s, ",") {
+			if strings.TrimSpace(existing) == style {
+				return
+			}
+		}
+		style = s + "," + style
+	}
+	attrs[string(gographviz.Style)] = quote(style)
+}
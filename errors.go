@@ -0,0 +1,58 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package relapseviz
+
+import "fmt"
+
+// UnknownNodeError is returned when the translator encounters an ast node
+// of a type it does not know how to translate.
+type UnknownNodeError struct {
+	// Path is the path from the ast.Grammar to the unknown node.
+	Path string
+	Node interface{}
+}
+
+func (e *UnknownNodeError) Error() string {
+	return fmt.Sprintf(`unknown ast node of type "%T" at %s`, e.Node, e.Path)
+}
+
+// GraphError is returned when the graphviz graph could not be constructed,
+// for example because of an unknown attribute.
+type GraphError struct {
+	// Path is the path from the ast.Grammar to the node being translated,
+	// empty if the error concerns the graph itself.
+	Path string
+	Err  error
+}
+
+func (e *GraphError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("graph construction failed: %v", e.Err)
+	}
+	return fmt.Sprintf("graph construction failed at %s: %v", e.Path, e.Err)
+}
+
+func (e *GraphError) Unwrap() error {
+	return e.Err
+}
+
+// UnknownPatternError is returned when the grammar is focused on a PatternDecl which it does not declare.
+type UnknownPatternError struct {
+	Name string
+}
+
+func (e *UnknownPatternError) Error() string {
+	return fmt.Sprintf("no pattern declaration named %q", e.Name)
+}
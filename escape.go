@@ -0,0 +1,167 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package relapseviz
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Every text which ends up inside the dot output, such as labels, ids and attribute values,
+// goes through escape or htmlText, since grammars can hold any string in their names, values and comments.
+// The outputs which are written from the graph, such as mermaid, the html viewer and the diff, read it back with unquoteDot and labelText.
+
+func quote(s string) string {
+	return `"` + s + `"`
+}
+
+var dotEscapes = map[rune]string{
+	'\\': `\\`,
+	'"':  `\"`,
+	'\n': `\n`,
+}
+
+// escape escapes text to be used inside a quoted dot string, where newlines become line breaks.
+// Other control characters and bytes which are not valid UTF-8, which dot or the svg rendered from it reject,
+// are written as Go escapes, such as \x00 or \t.
+func escape(s string) string {
+	return escapeWith(s, dotEscapes)
+}
+
+var htmlEscapes = map[rune]string{
+	'&':  `&amp;`,
+	'<':  `&lt;`,
+	'>':  `&gt;`,
+	'"':  `&quot;`,
+	'\n': `<br/>`,
+}
+
+// htmlText escapes text to be used inside an html-like label, where newlines become line breaks,
+// and the other control characters and invalid bytes are written as Go escapes, as by escape.
+func htmlText(s string) string {
+	return escapeWith(s, htmlEscapes)
+}
+
+// escapeWith replaces the runes of the text which have an escape, and writes the control characters,
+// unprintable runes and invalid bytes as Go escapes, which are escaped in turn.
+func escapeWith(s string, escapes map[rune]string) string {
+	b := &strings.Builder{}
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch e, ok := escapes[r]; {
+		case r == utf8.RuneError && size == 1:
+			b.WriteString(escapeWith(fmt.Sprintf(`\x%02x`, s[i]), escapes))
+		case ok:
+			b.WriteString(e)
+		case r != ' ' && !unicode.IsPrint(r):
+			q := strconv.QuoteRune(r)
+			b.WriteString(escapeWith(q[1:len(q)-1], escapes))
+		default:
+			b.WriteRune(r)
+		}
+		i += size
+	}
+	return b.String()
+}
+
+var dotKeywords = map[string]bool{"node": true, "edge": true, "graph": true, "digraph": true, "subgraph": true, "strict": true}
+
+// dotID returns the id as it is if dot accepts it without quotes, such as cluster_main, or else quoted.
+func dotID(id string) string {
+	if id == "" || dotKeywords[strings.ToLower(id)] {
+		return quote(escape(id))
+	}
+	for i, r := range id {
+		letter := r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+		if !letter && (i == 0 || r < '0' || r > '9') {
+			return quote(escape(id))
+		}
+	}
+	return id
+}
+
+// unquoteDot removes the quotes around a dot string and replaces its escape sequences,
+// where the line breaks \n, \l and \r become newlines.
+func unquoteDot(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	s = s[1 : len(s)-1]
+	b := &strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'l', 'r':
+			b.WriteByte('\n')
+		case '"', '\\':
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// labelText returns the text of a dot label, where the rows of an html-like table label become lines,
+// with the cells of a row separated by a colon, such as "Pipe: |".
+func labelText(l string) string {
+	if !strings.HasPrefix(l, "<") || !strings.HasSuffix(l, ">") {
+		return unquoteDot(l)
+	}
+	var lines []string
+	var cells []string
+	b := &strings.Builder{}
+	s := l[1 : len(l)-1]
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '<')
+		j := strings.IndexByte(s, '>')
+		if i < 0 || j < i {
+			b.WriteString(s)
+			break
+		}
+		b.WriteString(s[:i])
+		tag := strings.Fields(strings.Trim(s[i+1:j], "/ ") + " ")[0]
+		closing := s[i+1] == '/'
+		s = s[j+1:]
+		switch {
+		case tag == "td" && closing:
+			cells = append(cells, html.UnescapeString(b.String()))
+			b.Reset()
+		case tag == "tr" && closing, tag == "br":
+			if b.Len() > 0 {
+				cells = append(cells, html.UnescapeString(b.String()))
+				b.Reset()
+			}
+			lines = append(lines, strings.Join(cells, ": "))
+			cells = nil
+		}
+	}
+	if b.Len() > 0 {
+		cells = append(cells, html.UnescapeString(b.String()))
+	}
+	if len(cells) > 0 {
+		lines = append(lines, strings.Join(cells, ": "))
+	}
+	return strings.Join(lines, "\n")
+}
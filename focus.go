@@ -0,0 +1,99 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package relapseviz
+
+import (
+	"github.com/katydid/katydid/relapse/ast"
+)
+
+// Focus returns a grammar which only contains the named PatternDecl, or the TopPattern if the name is main,
+// and the PatternDecls which it references, up to depth references away, where a negative depth follows every reference.
+// It is used to focus the railroad diagrams and the automaton, while TranslateGrammar focuses with Options.Focus.
+// The returned error is an *UnknownPatternError if the grammar has no such PatternDecl.
+func Focus(g *ast.Grammar, name string, depth int) (*ast.Grammar, error) {
+	keep, err := focusDecls(g, name, depth)
+	if err != nil {
+		return nil, err
+	}
+	focused := &ast.Grammar{}
+	if keep["main"] {
+		focused.TopPattern = g.TopPattern
+	}
+	for _, pdecl := range g.PatternDecls {
+		if keep[pdecl.Name] {
+			focused.PatternDecls = append(focused.PatternDecls, pdecl)
+		}
+	}
+	return focused, nil
+}
+
+// focusDecls returns the names of the PatternDecls which are reached from the named PatternDecl
+// by following at most depth references, where the TopPattern is named main.
+func focusDecls(g *ast.Grammar, name string, depth int) (map[string]bool, error) {
+	decls := make(map[string]*ast.Pattern)
+	for _, pdecl := range g.PatternDecls {
+		decls[pdecl.Name] = pdecl.Pattern
+	}
+	if g.TopPattern != nil {
+		decls["main"] = g.TopPattern
+	}
+	if _, ok := decls[name]; !ok {
+		return nil, &UnknownPatternError{Name: name}
+	}
+	keep := map[string]bool{name: true}
+	next := []string{name}
+	for d := 0; len(next) > 0 && (depth < 0 || d < depth); d++ {
+		var refs []string
+		for _, n := range next {
+			for _, ref := range references(decls[n]) {
+				if _, ok := decls[ref]; ok && !keep[ref] {
+					keep[ref] = true
+					refs = append(refs, ref)
+				}
+			}
+		}
+		next = refs
+	}
+	return keep, nil
+}
+
+// references returns the names of the PatternDecls which the pattern refers to.
+func references(p *ast.Pattern) []string {
+	switch {
+	case p == nil:
+		return nil
+	case p.TreeNode != nil:
+		return references(p.TreeNode.Pattern)
+	case p.Concat != nil:
+		return append(references(p.Concat.LeftPattern), references(p.Concat.RightPattern)...)
+	case p.Or != nil:
+		return append(references(p.Or.LeftPattern), references(p.Or.RightPattern)...)
+	case p.And != nil:
+		return append(references(p.And.LeftPattern), references(p.And.RightPattern)...)
+	case p.ZeroOrMore != nil:
+		return references(p.ZeroOrMore.Pattern)
+	case p.Reference != nil:
+		return []string{p.Reference.Name}
+	case p.Not != nil:
+		return references(p.Not.Pattern)
+	case p.Contains != nil:
+		return references(p.Contains.Pattern)
+	case p.Optional != nil:
+		return references(p.Optional.Pattern)
+	case p.Interleave != nil:
+		return append(references(p.Interleave.LeftPattern), references(p.Interleave.RightPattern)...)
+	}
+	return nil
+}
@@ -15,16 +15,16 @@
 package relapseviz
 
 import (
-	"bytes"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"math/rand"
 	"reflect"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/awalterschulze/gographviz"
-	"github.com/jmarais/relapseviz/svg"
 	"github.com/katydid/katydid/relapse"
 	"github.com/katydid/katydid/relapse/ast"
 	"github.com/katydid/katydid/relapse/types"
@@ -32,38 +32,98 @@ import (
 
 type translator struct {
 	graph *gographviz.Graph
-	full  bool
+	opts  Options
 	r     *rand.Rand
+	n     int
+	ids   map[string]int
+	path  []string
+	depth int
+	// kind is the ast type name of the node being translated, which selects its style in the Theme.
+	kind string
+	err  error
+
+	// decl is the name of the PatternDecl being translated
+	// and parent the name of the (sub)graph its nodes are added to.
+	decl   string
+	parent string
+	decls  map[string]string
+	refs   []reference
+	// focus holds the names of the PatternDecls which are translated, nil if all of them are.
+	focus map[string]bool
+	// ports holds the fields which have a row in the html label of each node, from which the edges to their children leave.
+	ports map[string]map[string]bool
+	// text finds the relapse source of the nodes, if Options.Sources is set.
+	text *sourceText
+}
+
+func newTranslator(opts Options) *translator {
+	return &translator{
+		graph: gographviz.NewGraph(),
+		opts:  opts,
+		r:     rand.New(rand.NewSource(opts.Seed)),
+		decls: make(map[string]string),
+		ports: make(map[string]map[string]bool),
+	}
 }
 
-func Translate(s string, full bool) (*gographviz.Graph, error) {
+// Translate parses the relapse string and translates the resulting
+// ast.Grammar to a graphviz Graph using the given options.
+func Translate(s string, opts Options) (*gographviz.Graph, error) {
 	g, err := relapse.Parse(s)
 	if err != nil {
 		return nil, err
 	}
-	return TranslateGrammar(g, full), nil
+	return TranslateGrammar(g, opts)
 }
 
 // Translate the given ast.Grammer to a graphviz Graph.
-// 'full' traverse extra nodes which the relapse walker skips.
+// The options select which extra nodes, which the relapse walker skips, are traversed.
 // The node names are generated from the ast type name while a edge
 // name will be the fieldname of the edge source.
 // The list of struct fields are also listed in the node under the name.
-func TranslateGrammar(g *ast.Grammar, full bool) *gographviz.Graph {
-	t := &translator{
-		graph: gographviz.NewGraph(),
-		full:  full,
-		r:     rand.New(rand.NewSource(0)),
+// The returned error is either an *UnknownNodeError, a *GraphError or,
+// if Options.Focus names a pattern which is not declared, an *UnknownPatternError.
+func TranslateGrammar(g *ast.Grammar, opts Options) (*gographviz.Graph, error) {
+	t := newTranslator(opts)
+	if opts.Focus != "" {
+		focus, err := focusDecls(g, opts.Focus, opts.FocusDepth)
+		if err != nil {
+			return nil, err
+		}
+		t.focus = focus
+	}
+	if opts.Sources {
+		t.text = newSourceText(g)
+	}
+	if err := t.setGraph(); err != nil {
+		return nil, err
 	}
-	if err := t.graph.SetName("Relapse"); err != nil {
-		panic(err)
+	t.path = []string{getTypeName(g)}
+	t.translate(g, t.rootNodeId(g))
+	if opts.References {
+		t.addReferences()
+	}
+	if t.err != nil {
+		return nil, t.err
+	}
+	return t.graph, nil
+}
+
+// setGraph names the directed graph and adds the graph attributes.
+func (t *translator) setGraph() error {
+	if err := t.graph.SetName(dotID(t.opts.graphName())); err != nil {
+		return &GraphError{Err: err}
 	}
 	if err := t.graph.SetDir(true); err != nil {
-		panic(err)
+		return &GraphError{Err: err}
 	}
-	nodeLabel := getTypeName(g)
-	t.translate(g, nodeLabel, `root`)
-	return t.graph
+	for field, value := range t.opts.graphAttrs() {
+		if err := t.graph.AddAttr(t.graph.Name, field, value); err != nil {
+			return &GraphError{Err: err}
+		}
+	}
+	t.parent = t.graph.Name
+	return nil
 }
 
 // Get the ast type name
@@ -74,57 +134,52 @@ func getTypeName(v interface{}) string {
 	return ss[len(ss)-1]
 }
 
-func (t *translator) translate(node interface{}, nodeName, suffix string) {
-	nodeId := nodeName + suffix
-	label := newLabel(nodeName)
+func (t *translator) translate(node interface{}, nodeId string) {
+	t.kind = getTypeName(node)
+	if t.opts.Compact {
+		t.compact(node, nodeId)
+		return
+	}
+	label := newLabel(getTypeName(node), t.opts.Labels, t.opts.HTMLLabels)
+	if label.html {
+		t.ports[nodeId] = label.ports
+	}
 	switch v := node.(type) {
 	case *ast.Grammar:
 		if v.After != nil {
-			label.write(`\nAfter: \"`, v.After.String(), `\"`)
+			label.quoted(`After`, v.After.String())
 		}
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
-		if v.TopPattern != nil {
-			t.down(nodeId, v.TopPattern, `TopPattern`)
-		}
-		for i, pdecl := range v.PatternDecls {
-			nextNodeName := getTypeName(pdecl)
-			suff := strconv.FormatUint(t.r.Uint64(), 10)
-			t.addEdge(nodeId, nextNodeName+suff, map[string]string{attrLabel: fmt.Sprintf(`"%v[%d]"`, `PatternDecls`, i)})
-			t.translate(pdecl, nextNodeName, suff)
-		}
-		if t.full {
-			if v.After != nil {
-				t.down(nodeId, v.After, `After`)
-			}
+		t.patterns(nodeId, v)
+		if v.After != nil {
+			t.down(nodeId, v.After, `After`)
 		}
 	case *ast.PatternDecl:
+		t.decls[v.Name] = nodeId
 		if v.Hash != nil {
-			label.write(`\nHash: `, v.Hash.String())
+			label.field(`Hash`, v.Hash.String())
 		}
 		if v.Before != nil {
-			label.write(`\nBefore: \"`, v.Before.String(), `\"`)
+			label.quoted(`Before`, v.Before.String())
 		}
 		if v.Name != "" {
-			label.write(`\nName: `, v.Name)
+			label.field(`Name`, v.Name)
 		}
 		if v.Eq != nil {
-			label.write(`\nEq: `, v.Eq.String())
+			label.field(`Eq`, v.Eq.String())
 		}
 		if v.Pattern != nil {
-			label.write(`\nPattern: `, `Pattern`)
+			label.child(`Pattern`)
 		}
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
-
-		if t.full {
-			if v.Hash != nil {
-				t.down(nodeId, v.Hash, `Hash`)
-			}
-			if v.Eq != nil {
-				t.down(nodeId, v.Eq, `Eq`)
-			}
-			if v.Before != nil {
-				t.down(nodeId, v.Before, `Before`)
-			}
+		if v.Hash != nil {
+			t.down(nodeId, v.Hash, `Hash`)
+		}
+		if v.Eq != nil {
+			t.down(nodeId, v.Eq, `Eq`)
+		}
+		if v.Before != nil {
+			t.down(nodeId, v.Before, `Before`)
 		}
 		if v.Pattern != nil {
 			t.down(nodeId, v.Pattern, `Pattern`)
@@ -172,368 +227,317 @@ func (t *translator) translate(node interface{}, nodeName, suffix string) {
 		}
 	case *ast.Empty:
 		if v.Empty != nil {
-			label.write(`\nEmpty: \"`, v.Empty.String(), `\"`)
+			label.quoted(`Empty`, v.Empty.String())
 		}
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
-		if t.full {
-			if v.Empty != nil {
-				t.down(nodeId, v.Empty, `Empty`)
-			}
+		if v.Empty != nil {
+			t.down(nodeId, v.Empty, `Empty`)
 		}
 	case *ast.TreeNode:
 		if v.Name != nil {
-			label.write(`\nName: `, v.Name.String())
+			label.field(`Name`, v.Name.String())
 		}
 		if v.Colon != nil {
-			label.write(`\nColon: `, v.Colon.String())
+			label.field(`Colon`, v.Colon.String())
 		}
 		if v.Pattern != nil {
-			label.write(`\nPattern: `, `Pattern`)
+			label.child(`Pattern`)
 		}
-		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
+		t.addNode(nodeId, t.matched(v, map[string]string{attrLabel: label.finish()}))
 		if v.Name != nil {
 			t.down(nodeId, v.Name, `Name`)
 		}
-		if t.full {
-			if v.Colon != nil {
-				t.down(nodeId, v.Colon, `Colon`)
-			}
+		if v.Colon != nil {
+			t.down(nodeId, v.Colon, `Colon`)
 		}
 		if v.Pattern != nil {
 			t.down(nodeId, v.Pattern, `Pattern`)
 		}
 	case *ast.Contains:
 		if v.Dot != nil {
-			label.write(`\nDot: `, v.Dot.String())
+			label.field(`Dot`, v.Dot.String())
 		}
 		if v.Pattern != nil {
-			label.write(`\nPattern: `, `Pattern`)
+			label.child(`Pattern`)
 		}
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
-		if t.full {
-			if v.Dot != nil {
-				t.down(nodeId, v.Dot, `Dot`)
-			}
+		if v.Dot != nil {
+			t.down(nodeId, v.Dot, `Dot`)
 		}
 		if v.Pattern != nil {
 			t.down(nodeId, v.Pattern, `Pattern`)
 		}
 	case *ast.LeafNode:
 		if v.Expr != nil {
-			label.write(`\nExpr: `, `Expr`)
+			label.child(`Expr`)
 		}
-		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
+		t.addNode(nodeId, t.matched(v, map[string]string{attrLabel: label.finish()}))
 		if v.Expr != nil {
 			t.down(nodeId, v.Expr, `Expr`)
 		}
 	case *ast.Concat:
 		if v.OpenBracket != nil {
-			label.write(`\nOpenBracket: `, v.OpenBracket.String())
+			label.field(`OpenBracket`, v.OpenBracket.String())
 		}
 		if v.LeftPattern != nil {
-			label.write(`\nLeftPattern: `, `LeftPattern`)
+			label.child(`LeftPattern`)
 		}
 		if v.Comma != nil {
-			label.write(`\nComma: `, v.Comma.String())
+			label.field(`Comma`, v.Comma.String())
 		}
 		if v.RightPattern != nil {
-			label.write(`\nRightPattern: `, `RightPattern`)
+			label.child(`RightPattern`)
 		}
 		if v.ExtraComma != nil {
-			label.write(`\nComma: `, v.ExtraComma.String())
+			label.field(`ExtraComma`, v.ExtraComma.String())
 		}
-		if v.OpenBracket != nil {
-			label.write(`\nCloseBracket: `, v.CloseBracket.String())
+		if v.CloseBracket != nil {
+			label.field(`CloseBracket`, v.CloseBracket.String())
 		}
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
-		if t.full {
-			if v.OpenBracket != nil {
-				t.down(nodeId, v.OpenBracket, `OpenBracket`)
-			}
+		if v.OpenBracket != nil {
+			t.down(nodeId, v.OpenBracket, `OpenBracket`)
 		}
 		if v.LeftPattern != nil {
 			t.down(nodeId, v.LeftPattern, `LeftPattern`)
 		}
-		if t.full {
-			if v.Comma != nil {
-				t.down(nodeId, v.Comma, `Comma`)
-			}
+		if v.Comma != nil {
+			t.down(nodeId, v.Comma, `Comma`)
 		}
 		if v.RightPattern != nil {
 			t.down(nodeId, v.RightPattern, `RightPattern`)
 		}
-		if t.full {
-			if v.ExtraComma != nil {
-				t.down(nodeId, v.ExtraComma, `ExtraComma`)
-			}
-			if v.CloseBracket != nil {
-				t.down(nodeId, v.CloseBracket, `CloseBracket`)
-			}
+		if v.ExtraComma != nil {
+			t.down(nodeId, v.ExtraComma, `ExtraComma`)
+		}
+		if v.CloseBracket != nil {
+			t.down(nodeId, v.CloseBracket, `CloseBracket`)
 		}
 	case *ast.Or:
 		if v.OpenParen != nil {
-			label.write(`\nOpenParen: `, v.OpenParen.String())
+			label.field(`OpenParen`, v.OpenParen.String())
 		}
 		if v.LeftPattern != nil {
-			label.write(`\nLeftPattern: `, `LeftPattern`)
+			label.child(`LeftPattern`)
 		}
 		if v.Pipe != nil {
-			label.write(`\nPipe: `, v.Pipe.String())
+			label.field(`Pipe`, v.Pipe.String())
 		}
 		if v.RightPattern != nil {
-			label.write(`\nRightPattern: `, `RightPattern`)
+			label.child(`RightPattern`)
 		}
 		if v.CloseParen != nil {
-			label.write(`\nCloseParen: `, v.CloseParen.String())
+			label.field(`CloseParen`, v.CloseParen.String())
 		}
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
-		if t.full {
-			if v.OpenParen != nil {
-				t.down(nodeId, v.OpenParen, `OpenParen`)
-			}
+		if v.OpenParen != nil {
+			t.down(nodeId, v.OpenParen, `OpenParen`)
 		}
 		if v.LeftPattern != nil {
 			t.down(nodeId, v.LeftPattern, `LeftPattern`)
 		}
-		if t.full {
-			if v.Pipe != nil {
-				t.down(nodeId, v.Pipe, `Pipe`)
-			}
+		if v.Pipe != nil {
+			t.down(nodeId, v.Pipe, `Pipe`)
 		}
 		if v.RightPattern != nil {
 			t.down(nodeId, v.RightPattern, `RightPattern`)
 		}
-		if t.full {
-			if v.CloseParen != nil {
-				t.down(nodeId, v.CloseParen, `CloseParen`)
-			}
+		if v.CloseParen != nil {
+			t.down(nodeId, v.CloseParen, `CloseParen`)
 		}
 	case *ast.And:
 		if v.OpenParen != nil {
-			label.write(`\nOpenParen: `, v.OpenParen.String())
+			label.field(`OpenParen`, v.OpenParen.String())
 		}
 		if v.LeftPattern != nil {
-			label.write(`\nLeftPattern: `, `LeftPattern`)
+			label.child(`LeftPattern`)
 		}
 		if v.Ampersand != nil {
-			label.write(`\nAmpersand: `, v.Ampersand.String())
+			label.field(`Ampersand`, v.Ampersand.String())
 		}
 		if v.RightPattern != nil {
-			label.write(`\nRightPattern: `, `RightPattern`)
+			label.child(`RightPattern`)
 		}
 		if v.CloseParen != nil {
-			label.write(`\nCloseParen: `, v.CloseParen.String())
+			label.field(`CloseParen`, v.CloseParen.String())
 		}
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
-		if t.full {
-			if v.OpenParen != nil {
-				t.down(nodeId, v.OpenParen, `OpenParen`)
-			}
+		if v.OpenParen != nil {
+			t.down(nodeId, v.OpenParen, `OpenParen`)
 		}
 		if v.LeftPattern != nil {
 			t.down(nodeId, v.LeftPattern, `LeftPattern`)
 		}
-		if t.full {
-			if v.Ampersand != nil {
-				t.down(nodeId, v.Ampersand, `Ampersand`)
-			}
+		if v.Ampersand != nil {
+			t.down(nodeId, v.Ampersand, `Ampersand`)
 		}
 		if v.RightPattern != nil {
 			t.down(nodeId, v.RightPattern, `RightPattern`)
 		}
-		if t.full {
-			if v.CloseParen != nil {
-				t.down(nodeId, v.CloseParen, `CloseParen`)
-			}
+		if v.CloseParen != nil {
+			t.down(nodeId, v.CloseParen, `CloseParen`)
 		}
 	case *ast.ZeroOrMore:
 		if v.OpenParen != nil {
-			label.write(`\nOpenParen: `, v.OpenParen.String())
+			label.field(`OpenParen`, v.OpenParen.String())
 		}
 		if v.Pattern != nil {
-			label.write(`\nPattern: `, `Pattern`)
+			label.child(`Pattern`)
 		}
 		if v.CloseParen != nil {
-			label.write(`\nCloseParen: `, v.CloseParen.String())
+			label.field(`CloseParen`, v.CloseParen.String())
 		}
 		if v.Star != nil {
-			label.write(`\nStar: `, v.Star.String())
+			label.field(`Star`, v.Star.String())
 		}
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
-		if t.full {
-			if v.OpenParen != nil {
-				t.down(nodeId, v.OpenParen, `OpenParen`)
-			}
+		if v.OpenParen != nil {
+			t.down(nodeId, v.OpenParen, `OpenParen`)
 		}
 		if v.Pattern != nil {
 			t.down(nodeId, v.Pattern, `Pattern`)
 		}
-		if t.full {
-			if v.CloseParen != nil {
-				t.down(nodeId, v.CloseParen, `CloseParen`)
-			}
-			if v.Star != nil {
-				t.down(nodeId, v.Star, `Star`)
-			}
+		if v.CloseParen != nil {
+			t.down(nodeId, v.CloseParen, `CloseParen`)
+		}
+		if v.Star != nil {
+			t.down(nodeId, v.Star, `Star`)
 		}
 	case *ast.Reference:
 		if v.At != nil {
-			label.write(`\nAt: `, v.At.String())
+			label.field(`At`, v.At.String())
 		}
 		if v.Name != "" {
-			label.write(`\nName: `, v.Name)
+			label.field(`Name`, v.Name)
 		}
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
-		if t.full {
-			if v.At != nil {
-				t.down(nodeId, v.At, `At`)
-			}
+		t.refs = append(t.refs, reference{from: nodeId, decl: t.decl, name: v.Name})
+		if v.At != nil {
+			t.down(nodeId, v.At, `At`)
 		}
 	case *ast.Not:
 		if v.Exclamation != nil {
-			label.write(`\nExclamation: `, v.Exclamation.String())
+			label.field(`Exclamation`, v.Exclamation.String())
 		}
 		if v.OpenParen != nil {
-			label.write(`\nOpenParen: `, v.OpenParen.String())
+			label.field(`OpenParen`, v.OpenParen.String())
 		}
 		if v.Pattern != nil {
-			label.write(`\nPattern: `, `Pattern`)
+			label.child(`Pattern`)
 		}
 		if v.CloseParen != nil {
-			label.write(`\nCloseParen: `, v.CloseParen.String())
+			label.field(`CloseParen`, v.CloseParen.String())
 		}
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
-		if t.full {
-			if v.Exclamation != nil {
-				t.down(nodeId, v.Exclamation, `Exclamation`)
-			}
-			if v.OpenParen != nil {
-				t.down(nodeId, v.OpenParen, `OpenParen`)
-			}
+		if v.Exclamation != nil {
+			t.down(nodeId, v.Exclamation, `Exclamation`)
+		}
+		if v.OpenParen != nil {
+			t.down(nodeId, v.OpenParen, `OpenParen`)
 		}
 		if v.Pattern != nil {
 			t.down(nodeId, v.Pattern, `Pattern`)
 		}
-		if t.full {
-			if v.CloseParen != nil {
-				t.down(nodeId, v.CloseParen, `CloseParen`)
-			}
+		if v.CloseParen != nil {
+			t.down(nodeId, v.CloseParen, `CloseParen`)
 		}
 	case *ast.ZAny:
 		if v.Star != nil {
-			label.write(`\nStar: `, v.Star.String())
+			label.field(`Star`, v.Star.String())
 		}
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
-		if t.full {
-			if v.Star != nil {
-				t.down(nodeId, v.Star, `Star`)
-			}
+		if v.Star != nil {
+			t.down(nodeId, v.Star, `Star`)
 		}
 	case *ast.Optional:
 		if v.OpenParen != nil {
-			label.write(`\nOpenParen: `, v.OpenParen.String())
+			label.field(`OpenParen`, v.OpenParen.String())
 		}
 		if v.Pattern != nil {
-			label.write(`\nPattern: `, `Pattern`)
+			label.child(`Pattern`)
 		}
 		if v.CloseParen != nil {
-			label.write(`\nCloseParen: `, v.CloseParen.String())
+			label.field(`CloseParen`, v.CloseParen.String())
 		}
 		if v.QuestionMark != nil {
-			label.write(`\nQuestionMark: `, v.QuestionMark.String())
+			label.field(`QuestionMark`, v.QuestionMark.String())
 		}
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
-		if v.Pattern != nil {
-			t.down(nodeId, v.Pattern, `Pattern`)
-		}
-		if t.full {
-
-			if v.OpenParen != nil {
-				t.down(nodeId, v.OpenParen, `OpenParen`)
-			}
+		if v.OpenParen != nil {
+			t.down(nodeId, v.OpenParen, `OpenParen`)
 		}
 		if v.Pattern != nil {
 			t.down(nodeId, v.Pattern, `Pattern`)
 		}
-		if t.full {
-			if v.CloseParen != nil {
-				t.down(nodeId, v.CloseParen, `CloseParen`)
-			}
-			if v.QuestionMark != nil {
-				t.down(nodeId, v.QuestionMark, `QuestionMark`)
-			}
+		if v.CloseParen != nil {
+			t.down(nodeId, v.CloseParen, `CloseParen`)
+		}
+		if v.QuestionMark != nil {
+			t.down(nodeId, v.QuestionMark, `QuestionMark`)
 		}
 	case *ast.Interleave:
 		if v.OpenCurly != nil {
-			label.write(`\nOpenCurly: `, v.OpenCurly.String())
+			label.field(`OpenCurly`, v.OpenCurly.String())
 		}
 		if v.LeftPattern != nil {
-			label.write(`\nLeftPattern: `, `LeftPattern`)
+			label.child(`LeftPattern`)
 		}
 		if v.SemiColon != nil {
-			label.write(`\nSemiColon: `, v.SemiColon.String())
+			label.field(`SemiColon`, v.SemiColon.String())
 		}
 		if v.RightPattern != nil {
-			label.write(`\nRightPattern: `, `RightPattern`)
+			label.child(`RightPattern`)
 		}
 		if v.ExtraSemiColon != nil {
-			label.write(`\nExtraSemiColon: `, v.ExtraSemiColon.String())
+			label.field(`ExtraSemiColon`, v.ExtraSemiColon.String())
 		}
 		if v.CloseCurly != nil {
-			label.write(`\nCloseCurly: `, v.CloseCurly.String())
+			label.field(`CloseCurly`, v.CloseCurly.String())
 		}
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
-		if t.full {
-			if v.OpenCurly != nil {
-				t.down(nodeId, v.OpenCurly, `OpenCurly`)
-			}
+		if v.OpenCurly != nil {
+			t.down(nodeId, v.OpenCurly, `OpenCurly`)
 		}
 		if v.LeftPattern != nil {
 			t.down(nodeId, v.LeftPattern, `LeftPattern`)
 		}
-		if t.full {
-			if v.SemiColon != nil {
-				t.down(nodeId, v.SemiColon, `SemiColon`)
-			}
+		if v.SemiColon != nil {
+			t.down(nodeId, v.SemiColon, `SemiColon`)
 		}
 		if v.RightPattern != nil {
 			t.down(nodeId, v.RightPattern, `RightPattern`)
 		}
-		if t.full {
-			if v.ExtraSemiColon != nil {
-				t.down(nodeId, v.ExtraSemiColon, `ExtraSemiColon`)
-			}
-			if v.CloseCurly != nil {
-				t.down(nodeId, v.CloseCurly, `CloseCurly`)
-			}
+		if v.ExtraSemiColon != nil {
+			t.down(nodeId, v.ExtraSemiColon, `ExtraSemiColon`)
+		}
+		if v.CloseCurly != nil {
+			t.down(nodeId, v.CloseCurly, `CloseCurly`)
 		}
 	case *ast.Expr:
 		if v.RightArrow != nil {
-			label.write(`\nRightArrow: `, v.RightArrow.String())
+			label.field(`RightArrow`, v.RightArrow.String())
 		}
 		if v.Comma != nil {
-			label.write(`\nComma: `, v.Comma.String())
+			label.field(`Comma`, v.Comma.String())
 		}
 		if v.Terminal != nil {
-			label.write(`\nTerminal: `, `Terminal`)
+			label.child(`Terminal`)
 		}
 		if v.List != nil {
-			label.write(`\nList: `, `List`)
+			label.child(`List`)
 		}
 		if v.Function != nil {
-			label.write(`\nFunction: `, `Function`)
+			label.child(`Function`)
 		}
 		if v.BuiltIn != nil {
-			label.write(`\nBuiltIn: `, `BuiltIn`)
+			label.child(`BuiltIn`)
 		}
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
-		if t.full {
-			if v.RightArrow != nil {
-				t.down(nodeId, v.RightArrow, `RightArrow`)
-			}
-			if v.Comma != nil {
-				t.down(nodeId, v.Comma, `Comma`)
-			}
+		if v.RightArrow != nil {
+			t.down(nodeId, v.RightArrow, `RightArrow`)
+		}
+		if v.Comma != nil {
+			t.down(nodeId, v.Comma, `Comma`)
 		}
 		if v.Terminal != nil {
 			t.down(nodeId, v.Terminal, `Terminal`)
@@ -549,147 +553,127 @@ func (t *translator) translate(node interface{}, nodeName, suffix string) {
 		}
 	case *ast.List:
 		if v.Before != nil {
-			label.write(`\nBefore: \"`, v.Before.String(), `\"`)
+			label.quoted(`Before`, v.Before.String())
 		}
-		label.write(`\nType: `, types.Type_name[int32(v.Type)])
+		label.field(`Type`, types.Type_name[int32(v.Type)])
 		if v.OpenCurly != nil {
-			label.write(`\nOpenCurly: `, v.OpenCurly.String())
+			label.field(`OpenCurly`, v.OpenCurly.String())
 		}
 		if v.Elems != nil {
-			label.write(`\nElems: `, `Elems`)
+			label.child(`Elems`)
 		}
 		if v.CloseCurly != nil {
-			label.write(`\nCloseCurly: `, v.CloseCurly.String())
+			label.field(`CloseCurly`, v.CloseCurly.String())
 		}
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
-		if t.full {
-			if v.Before != nil {
-				t.down(nodeId, v.Before, `Before`)
-			}
-			if v.OpenCurly != nil {
-				t.down(nodeId, v.OpenCurly, `OpenCurly`)
-			}
+		if v.Before != nil {
+			t.down(nodeId, v.Before, `Before`)
+		}
+		if v.OpenCurly != nil {
+			t.down(nodeId, v.OpenCurly, `OpenCurly`)
 		}
 		for i, e := range v.GetElems() {
-			nextNodeName := getTypeName(e)
-			suff := strconv.FormatUint(t.r.Uint64(), 10)
-			t.addEdge(nodeId, nextNodeName+suff, map[string]string{attrLabel: fmt.Sprintf(`"%v[%d]"`, `Elems`, i)})
-			t.translate(e, nextNodeName, suff)
-		}
-		if t.full {
-			if v.CloseCurly != nil {
-				t.down(nodeId, v.CloseCurly, `CloseCurly`)
-			}
+			t.down(nodeId, e, index(`Elems`, i))
+		}
+		if v.CloseCurly != nil {
+			t.down(nodeId, v.CloseCurly, `CloseCurly`)
 		}
 	case *ast.Function:
 		if v.Before != nil {
-			label.write(`\nBefore: \"`, v.Before.String(), `\"`)
+			label.quoted(`Before`, v.Before.String())
 		}
 		if v.Name != "" {
-			label.write(`\nName: `, v.Name)
+			label.field(`Name`, v.Name)
 		}
 		if v.OpenParen != nil {
-			label.write(`\nOpenParen: `, v.OpenParen.String())
+			label.field(`OpenParen`, v.OpenParen.String())
 		}
 		if v.Params != nil {
-			label.write(`\nParams: `, `Params`)
+			label.child(`Params`)
 		}
 		if v.CloseParen != nil {
-			label.write(`\nCloseParen: `, v.CloseParen.String())
+			label.field(`CloseParen`, v.CloseParen.String())
 		}
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
-		if t.full {
-			if v.Before != nil {
-				t.down(nodeId, v.Before, `Before`)
-			}
-			if v.OpenParen != nil {
-				t.down(nodeId, v.OpenParen, `OpenParen`)
-			}
+		if v.Before != nil {
+			t.down(nodeId, v.Before, `Before`)
+		}
+		if v.OpenParen != nil {
+			t.down(nodeId, v.OpenParen, `OpenParen`)
 		}
 		for i, e := range v.GetParams() {
-			nextNodeName := getTypeName(e)
-			suff := strconv.FormatUint(t.r.Uint64(), 10)
-			t.addEdge(nodeId, nextNodeName+suff, map[string]string{attrLabel: fmt.Sprintf(`"%v[%d]"`, `Params`, i)})
-			t.translate(e, nextNodeName, suff)
-		}
-		if t.full {
-			if v.CloseParen != nil {
-				t.down(nodeId, v.CloseParen, `CloseParen`)
-			}
+			t.down(nodeId, e, index(`Params`, i))
+		}
+		if v.CloseParen != nil {
+			t.down(nodeId, v.CloseParen, `CloseParen`)
 		}
 	case *ast.BuiltIn:
 		if v.Symbol != nil {
-			label.write(`\nSymbol: `, v.Symbol.String())
+			label.field(`Symbol`, v.Symbol.String())
 		}
 		if v.Expr != nil {
-			label.write(`\nExpr: `, `Expr`)
+			label.child(`Expr`)
 		}
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
-		if t.full {
-			if v.Symbol != nil {
-				t.down(nodeId, v.Symbol, `Symbol`)
-			}
+		if v.Symbol != nil {
+			t.down(nodeId, v.Symbol, `Symbol`)
 		}
 		if v.Expr != nil {
 			t.down(nodeId, v.Expr, `Expr`)
 		}
 	case *ast.Terminal:
 		if v.Before != nil {
-			label.write(`\nBefore: \"`, v.Before.String(), `\"`)
+			label.quoted(`Before`, v.Before.String())
 		}
 		if v.Literal != "" {
-			label.write(`\nLiteral: `, strings.Replace(v.Literal, "\"", "\\\"", -1))
+			label.field(`Literal`, v.Literal)
 		}
 		if v.DoubleValue != nil {
-			label.write(`\nDoubleValue: `, strconv.FormatFloat(*v.DoubleValue, 'E', -1, 64))
+			label.field(`DoubleValue`, strconv.FormatFloat(*v.DoubleValue, 'E', -1, 64))
 		}
 		if v.IntValue != nil {
-			label.write(`\nIntValue: `, strconv.FormatInt(*v.IntValue, 10))
+			label.field(`IntValue`, strconv.FormatInt(*v.IntValue, 10))
 		}
 		if v.UintValue != nil {
-			label.write(`\nUintValue: `, strconv.FormatUint(*v.UintValue, 10))
+			label.field(`UintValue`, strconv.FormatUint(*v.UintValue, 10))
 		}
 		if v.BoolValue != nil {
-			label.write(`\nBoolValue: `, strconv.FormatBool(*v.BoolValue))
+			label.field(`BoolValue`, strconv.FormatBool(*v.BoolValue))
 		}
 		if v.StringValue != nil {
-			label.write(`\nStringValue: `, *v.StringValue)
+			label.field(`StringValue`, *v.StringValue)
 		}
 		if v.BytesValue != nil {
-			label.write(`\nBytesValue: `, string(v.BytesValue))
+			label.field(`BytesValue`, fmt.Sprintf("%q", v.BytesValue))
 		}
 		if v.Variable != nil {
-			label.write(`\nVariable: `, `Variable`)
+			label.child(`Variable`)
 		}
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
-		if t.full {
-			if v.Before != nil {
-				t.down(nodeId, v.Before, `Before`)
-			}
+		if v.Before != nil {
+			t.down(nodeId, v.Before, `Before`)
 		}
 		if v.Variable != nil {
 			t.down(nodeId, v.Variable, `Variable`)
 		}
 	case *ast.Variable:
 		name := types.Type_name[int32(v.Type)]
-		label.write(`:\nType:`, name)
+		label.field(`Type`, name)
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
 	case *ast.Keyword:
 		if v.Before != nil {
-			label.write(`\nBefore: \"`, v.Before.String(), `\"`)
+			label.quoted(`Before`, v.Before.String())
 		}
 		if v.Value != "" {
-			label.write(`\nValue: \"`, v.Value, `\"`)
+			label.quoted(`Value`, v.Value)
 		}
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
-		if t.full {
-			if v.Before != nil {
-				t.down(nodeId, v.Before, `Before`)
-			}
+		if v.Before != nil {
+			t.down(nodeId, v.Before, `Before`)
 		}
 	case *ast.Space:
 		for i, s := range v.Space {
-			label.write(`\nSpace[`, strconv.Itoa(i), `]: \"`, s, `\"`)
+			label.quoted(`Space[`+strconv.Itoa(i)+`]`, s)
 		}
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
 	case *ast.NameExpr:
@@ -708,155 +692,565 @@ func (t *translator) translate(node interface{}, nodeName, suffix string) {
 		}
 	case *ast.Name:
 		if v.Before != nil {
-			label.write(`\nBefore: \"`, v.Before.String(), `\"`)
+			label.quoted(`Before`, v.Before.String())
 		}
 		if v.DoubleValue != nil {
-			label.write(`\nDoubleValue: `, strconv.FormatFloat(*v.DoubleValue, 'E', -1, 64))
+			label.field(`DoubleValue`, strconv.FormatFloat(*v.DoubleValue, 'E', -1, 64))
 		}
 		if v.IntValue != nil {
-			label.write(`\nIntValue: `, strconv.FormatInt(*v.IntValue, 10))
+			label.field(`IntValue`, strconv.FormatInt(*v.IntValue, 10))
 		}
 		if v.UintValue != nil {
-			label.write(`\nUintValue: `, strconv.FormatUint(*v.UintValue, 10))
+			label.field(`UintValue`, strconv.FormatUint(*v.UintValue, 10))
 		}
 		if v.BoolValue != nil {
-			label.write(`\nBoolValue: `, strconv.FormatBool(*v.BoolValue))
+			label.field(`BoolValue`, strconv.FormatBool(*v.BoolValue))
 		}
 		if v.StringValue != nil {
-			label.write(`\nStringValue: `, *v.StringValue)
+			label.field(`StringValue`, *v.StringValue)
 		}
 		if v.BytesValue != nil {
-			label.write(`\nBytesValue: `, string(v.BytesValue))
+			label.field(`BytesValue`, fmt.Sprintf("%q", v.BytesValue))
 		}
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
 	case *ast.AnyName:
 		if v.Underscore != nil {
-			label.write(`\nUnderscore: `, v.Underscore.String())
+			label.field(`Underscore`, v.Underscore.String())
 		}
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
-		if t.full {
-			if v.Underscore != nil {
-				t.down(nodeId, v.Underscore, `Underscore`)
-			}
+		if v.Underscore != nil {
+			t.down(nodeId, v.Underscore, `Underscore`)
 		}
 	case *ast.AnyNameExcept:
 		if v.Exclamation != nil {
-			label.write(`\nExclamation: `, v.Exclamation.String())
+			label.field(`Exclamation`, v.Exclamation.String())
 		}
 		if v.OpenParen != nil {
-			label.write(`\nOpenParen: `, v.OpenParen.String())
+			label.field(`OpenParen`, v.OpenParen.String())
 		}
 		if v.Except != nil {
-			label.write(`\nExcept: `, `Except`)
+			label.child(`Except`)
 		}
 		if v.CloseParen != nil {
-			label.write(`\nCloseParen: `, v.CloseParen.String())
+			label.field(`CloseParen`, v.CloseParen.String())
 		}
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
-		if t.full {
-			if v.Exclamation != nil {
-				t.down(nodeId, v.Exclamation, `Exclamation`)
-			}
-			if v.OpenParen != nil {
-				t.down(nodeId, v.OpenParen, `OpenParen`)
-			}
+		if v.Exclamation != nil {
+			t.down(nodeId, v.Exclamation, `Exclamation`)
+		}
+		if v.OpenParen != nil {
+			t.down(nodeId, v.OpenParen, `OpenParen`)
 		}
 		if v.Except != nil {
 			t.down(nodeId, v.Except, `Except`)
 		}
-		if t.full {
-			if v.CloseParen != nil {
-				t.down(nodeId, v.CloseParen, `CloseParen`)
-			}
+		if v.CloseParen != nil {
+			t.down(nodeId, v.CloseParen, `CloseParen`)
 		}
 	case *ast.NameChoice:
 		if v.OpenParen != nil {
-			label.write(`\nOpenParen: `, v.OpenParen.String())
+			label.field(`OpenParen`, v.OpenParen.String())
 		}
 		if v.Left != nil {
-			label.write(`\nLeft: `, `Left`)
+			label.child(`Left`)
 		}
 		if v.Pipe != nil {
-			label.write(`\nPipe: `, v.Pipe.String())
+			label.field(`Pipe`, v.Pipe.String())
 		}
 		if v.Right != nil {
-			label.write(`\nRight: `, `Right`)
+			label.child(`Right`)
 		}
 		if v.CloseParen != nil {
-			label.write(`\nCloseParen: `, v.CloseParen.String())
+			label.field(`CloseParen`, v.CloseParen.String())
 		}
 		t.addNode(nodeId, map[string]string{attrLabel: label.finish()})
-		if t.full {
-			if v.OpenParen != nil {
-				t.down(nodeId, v.OpenParen, `OpenParen`)
-			}
+		if v.OpenParen != nil {
+			t.down(nodeId, v.OpenParen, `OpenParen`)
 		}
 		if v.Left != nil {
 			t.down(nodeId, v.Left, `Left`)
 
 		}
-		if t.full {
-			if v.Pipe != nil {
-				t.down(nodeId, v.Pipe, `Pipe`)
-			}
+		if v.Pipe != nil {
+			t.down(nodeId, v.Pipe, `Pipe`)
 		}
 		if v.Right != nil {
 			t.down(nodeId, v.Right, `Right`)
 		}
-		if t.full {
-			if v.CloseParen != nil {
-				t.down(nodeId, v.CloseParen, `CloseParen`)
-			}
+		if v.CloseParen != nil {
+			t.down(nodeId, v.CloseParen, `CloseParen`)
 		}
 	default:
-		panic(fmt.Sprintf(`unknown ast node of type "%T" and value "%v"`, v, v))
+		t.fail(&UnknownNodeError{Path: t.pathString(), Node: v})
 	}
 }
 
 var attrLabel = string(gographviz.Label)
 
-func (t *translator) down(nodeId string, to interface{}, edgeLabelName string) {
-	nextNodeName := getTypeName(to)
-	suffix := strconv.FormatUint(t.r.Uint64(), 10)
-	t.addEdge(nodeId, nextNodeName+suffix, map[string]string{attrLabel: edgeLabelName})
-	t.translate(to, nextNodeName, suffix)
+// patterns translates the TopPattern and the PatternDecls of the grammar, which are in focus.
+// The PatternDecls out of focus are skipped, but keep their index in the path.
+func (t *translator) patterns(nodeId string, g *ast.Grammar) {
+	if g.TopPattern != nil && t.focused("main") {
+		t.enter("main")
+		t.decls["main"] = t.down(nodeId, g.TopPattern, `TopPattern`)
+	}
+	for i, pdecl := range g.PatternDecls {
+		if !t.focused(pdecl.Name) {
+			continue
+		}
+		t.enter(pdecl.Name)
+		t.down(nodeId, pdecl, index(`PatternDecls`, i))
+	}
+	t.enter("")
+}
+
+// focused returns whether the named PatternDecl is translated.
+func (t *translator) focused(decl string) bool {
+	return t.focus == nil || t.focus[decl]
+}
+
+// enter starts the translation of the named PatternDecl, or leaves it if the name is empty.
+// With clusters the nodes of the PatternDecl are added to its own subgraph.
+func (t *translator) enter(decl string) {
+	t.decl = decl
+	t.parent = t.graph.Name
+	if decl == "" || !t.opts.Clusters {
+		return
+	}
+	t.parent = dotID("cluster_" + decl)
+	if err := t.graph.AddSubGraph(t.graph.Name, t.parent, map[string]string{attrLabel: quote(escape(decl))}); err != nil {
+		t.fail(&GraphError{Path: t.pathString(), Err: err})
+	}
+}
+
+// down translates the child node found in the given field and returns its node id,
+// which is empty if the child is not visible.
+func (t *translator) down(nodeId string, to interface{}, field string) string {
+	if t.err != nil || !t.opts.visible(to) {
+		return ""
+	}
+	n := len(t.path)
+	t.path = append(t.path, field)
+	edgeAttrs := map[string]string{attrLabel: quote(field)}
+	if t.opts.Compact {
+		for p, ok := to.(*ast.Pattern); ok; p, ok = to.(*ast.Pattern) {
+			child, childField := unwrap(p)
+			if child == nil {
+				break
+			}
+			to = child
+			t.path = append(t.path, childField)
+		}
+		edgeAttrs = nil
+	}
+	nextNodeId := t.newNodeId(to)
+	port := strings.SplitN(field, "[", 2)[0]
+	if !t.ports[nodeId][port] {
+		port = ""
+	} else if port == field {
+		// the row of the field already names the edge
+		edgeAttrs = nil
+	}
+	t.addEdge(nodeId, port, nextNodeId, getTypeName(to), edgeAttrs)
+	restore := t.text.seek(to)
+	if !t.collapse(to, nextNodeId) {
+		t.depth++
+		t.translate(to, nextNodeId)
+		t.depth--
+	}
+	restore()
+	t.path = t.path[:n]
+	return nextNodeId
+}
+
+// maxSourceLen is the number of characters of relapse source shown by a collapsed node.
+const maxSourceLen = 60
+
+// collapse adds a single placeholder node instead of the subtree of the node, if it is below the MaxDepth,
+// labelled with the number of nodes it hides below the node and the relapse source of the subtree.
+// It returns false if the subtree is not collapsed, which includes subtrees of a single node.
+func (t *translator) collapse(node interface{}, nodeId string) bool {
+	if t.opts.MaxDepth <= 0 || t.depth < t.opts.MaxDepth {
+		return false
+	}
+	hidden := t.hidden(node)
+	if hidden == 0 || t.err != nil {
+		return false
+	}
+	t.kind = ""
+	l := fmt.Sprintf(`…\n%d hidden nodes`, hidden)
+	if s, ok := node.(fmt.Stringer); ok {
+		src := strings.TrimSpace(s.String())
+		if utf8.RuneCountInString(src) > maxSourceLen {
+			// cut between runes, where an invalid byte counts as a rune, to leave it for escape
+			n := 0
+			for i := range src {
+				if n == maxSourceLen-1 {
+					src = src[:i] + `…`
+					break
+				}
+				n++
+			}
+		}
+		l += `\n` + escape(src)
+	}
+	t.addNode(nodeId, map[string]string{
+		attrLabel:                    quote(l),
+		string(gographviz.Shape):     "box",
+		string(gographviz.Style):     "dashed",
+		string(gographviz.FontColor): "grey40",
+	})
+	return true
+}
+
+// hidden returns the number of nodes below the node, which are hidden by the placeholder standing in for it,
+// counted by walking the ast as it would be translated.
+func (t *translator) hidden(node interface{}) int {
+	n := 0
+	for _, c := range t.children(node) {
+		n += 1 + t.hidden(c)
+	}
+	return n
+}
+
+// children returns the children of the node which are translated as nodes of their own,
+// where the Pattern wrappers are elided in the compact view.
+func (t *translator) children(node interface{}) []interface{} {
+	var cs []interface{}
+	if t.opts.Compact {
+		cs = compactChildren(node)
+	} else {
+		cs = fullChildren(node)
+	}
+	if cs == nil {
+		t.fail(&UnknownNodeError{Path: t.pathString(), Node: node})
+		return nil
+	}
+	var visible []interface{}
+	for _, c := range cs {
+		if reflect.ValueOf(c).IsNil() || !t.opts.visible(c) {
+			continue
+		}
+		if t.opts.Compact {
+			for p, ok := c.(*ast.Pattern); ok; p, ok = c.(*ast.Pattern) {
+				child, _ := unwrap(p)
+				if child == nil {
+					break
+				}
+				c = child
+			}
+		}
+		visible = append(visible, c)
+	}
+	return visible
+}
+
+// fullChildren returns the children of the node as translate adds them, which may be nil pointers,
+// or nil if the node is unknown.
+func fullChildren(node interface{}) []interface{} {
+	switch v := node.(type) {
+	case *ast.PatternDecl:
+		return []interface{}{v.Hash, v.Eq, v.Before, v.Pattern}
+	case *ast.Pattern:
+		return []interface{}{v.Empty, v.TreeNode, v.LeafNode, v.Concat, v.Or, v.And, v.ZeroOrMore,
+			v.Reference, v.Not, v.ZAny, v.Contains, v.Optional, v.Interleave}
+	case *ast.Empty:
+		return []interface{}{v.Empty}
+	case *ast.TreeNode:
+		return []interface{}{v.Name, v.Colon, v.Pattern}
+	case *ast.Contains:
+		return []interface{}{v.Dot, v.Pattern}
+	case *ast.LeafNode:
+		return []interface{}{v.Expr}
+	case *ast.Concat:
+		return []interface{}{v.OpenBracket, v.LeftPattern, v.Comma, v.RightPattern, v.ExtraComma, v.CloseBracket}
+	case *ast.Or:
+		return []interface{}{v.OpenParen, v.LeftPattern, v.Pipe, v.RightPattern, v.CloseParen}
+	case *ast.And:
+		return []interface{}{v.OpenParen, v.LeftPattern, v.Ampersand, v.RightPattern, v.CloseParen}
+	case *ast.ZeroOrMore:
+		return []interface{}{v.OpenParen, v.Pattern, v.CloseParen, v.Star}
+	case *ast.Reference:
+		return []interface{}{v.At}
+	case *ast.Not:
+		return []interface{}{v.Exclamation, v.OpenParen, v.Pattern, v.CloseParen}
+	case *ast.ZAny:
+		return []interface{}{v.Star}
+	case *ast.Optional:
+		return []interface{}{v.OpenParen, v.Pattern, v.CloseParen, v.QuestionMark}
+	case *ast.Interleave:
+		return []interface{}{v.OpenCurly, v.LeftPattern, v.SemiColon, v.RightPattern, v.ExtraSemiColon, v.CloseCurly}
+	case *ast.Expr:
+		return []interface{}{v.RightArrow, v.Comma, v.Terminal, v.List, v.Function, v.BuiltIn}
+	case *ast.List:
+		cs := []interface{}{v.Before, v.OpenCurly}
+		for _, e := range v.GetElems() {
+			cs = append(cs, e)
+		}
+		return append(cs, v.CloseCurly)
+	case *ast.Function:
+		cs := []interface{}{v.Before, v.OpenParen}
+		for _, e := range v.GetParams() {
+			cs = append(cs, e)
+		}
+		return append(cs, v.CloseParen)
+	case *ast.BuiltIn:
+		return []interface{}{v.Symbol, v.Expr}
+	case *ast.Terminal:
+		return []interface{}{v.Before, v.Variable}
+	case *ast.Keyword:
+		return []interface{}{v.Before}
+	case *ast.NameExpr:
+		return []interface{}{v.Name, v.AnyName, v.AnyNameExcept, v.NameChoice}
+	case *ast.AnyName:
+		return []interface{}{v.Underscore}
+	case *ast.AnyNameExcept:
+		return []interface{}{v.Exclamation, v.OpenParen, v.Except, v.CloseParen}
+	case *ast.NameChoice:
+		return []interface{}{v.OpenParen, v.Left, v.Pipe, v.Right, v.CloseParen}
+	case *ast.Variable, *ast.Space, *ast.Name:
+		return []interface{}{}
+	}
+	return nil
+}
+
+// compactChildren returns the children of the node as compact adds them, which may be nil pointers,
+// or nil if the node is unknown.
+func compactChildren(node interface{}) []interface{} {
+	switch v := node.(type) {
+	case *ast.PatternDecl:
+		return []interface{}{v.Pattern}
+	case *ast.TreeNode:
+		return []interface{}{v.Pattern}
+	case *ast.Contains:
+		if v.Pattern != nil && v.Pattern.TreeNode != nil {
+			return []interface{}{v.Pattern.TreeNode.Pattern}
+		}
+		return []interface{}{v.Pattern}
+	case *ast.Concat:
+		return operandPatterns(v, `Concat`)
+	case *ast.Or:
+		return operandPatterns(v, `Or`)
+	case *ast.And:
+		return operandPatterns(v, `And`)
+	case *ast.Interleave:
+		return operandPatterns(v, `Interleave`)
+	case *ast.ZeroOrMore:
+		return []interface{}{v.Pattern}
+	case *ast.Optional:
+		return []interface{}{v.Pattern}
+	case *ast.Not:
+		return []interface{}{v.Pattern}
+	case *ast.Pattern, *ast.Empty, *ast.LeafNode, *ast.ZAny, *ast.Reference:
+		return []interface{}{}
+	}
+	return nil
+}
+
+// operandPatterns returns the operands of a chain of the same binary operator, as operands translates them.
+func operandPatterns(op interface{}, opField string) []interface{} {
+	cs := []interface{}{}
+	for _, o := range flatten(op, opField, nil) {
+		cs = append(cs, o.pattern)
+	}
+	return cs
+}
+
+// rootNodeId returns the node id of the ast.Grammar.
+func (t *translator) rootNodeId(g *ast.Grammar) string {
+	switch t.opts.IDs {
+	case PathIDs:
+		return quote(escape(t.pathString()))
+	case NamedPathIDs:
+		return quote(escape(t.namedPath()))
+	}
+	return getTypeName(g) + `root`
+}
+
+// newNodeId returns a unique node id for the node at the current path,
+// generated according to the IDStrategy.
+func (t *translator) newNodeId(node interface{}) string {
+	switch t.opts.IDs {
+	case SequentialIDs:
+		t.n++
+		return getTypeName(node) + strconv.Itoa(t.n)
+	case PathIDs:
+		return quote(escape(t.pathString()))
+	case NamedPathIDs:
+		return quote(escape(t.namedPath()))
+	case HashIDs:
+		h := fnv.New64a()
+		io.WriteString(h, t.stablePath())
+		if s, ok := node.(fmt.Stringer); ok {
+			io.WriteString(h, "=")
+			io.WriteString(h, s.String())
+		}
+		id := getTypeName(node) + strconv.FormatUint(h.Sum64(), 16)
+		if t.ids == nil {
+			t.ids = make(map[string]int)
+		}
+		t.ids[id]++
+		if n := t.ids[id]; n > 1 {
+			id += "_" + strconv.Itoa(n)
+		}
+		return id
+	default:
+		return getTypeName(node) + strconv.FormatUint(t.r.Uint64(), 10)
+	}
 }
 
+// stablePath returns the path to the current node, where the index of a PatternDecl
+// is replaced by its name and the indexes of other repeated fields are left out.
+func (t *translator) stablePath() string {
+	ss := make([]string, len(t.path))
+	for i, s := range t.path {
+		if i == 1 && strings.HasPrefix(s, `PatternDecls[`) {
+			ss[i] = "#" + t.decl
+		} else {
+			ss[i] = strings.SplitN(s, "[", 2)[0]
+		}
+	}
+	return strings.Join(ss, ".")
+}
+
+// namedPath returns the path to the current node, where the index of a PatternDecl is replaced by its name.
+func (t *translator) namedPath() string {
+	ss := append([]string(nil), t.path...)
+	if len(ss) > 1 && strings.HasPrefix(ss[1], `PatternDecls[`) {
+		ss[1] = "#" + t.decl
+	}
+	return strings.Join(ss, ".")
+}
+
+// addNode adds the node with the attributes, which override the source attributes of the current node,
+// Options.NodeAttrs and the Theme style of the current kind.
+// Nodes with an html label have no shape of their own, since the table draws the borders.
 func (t *translator) addNode(name string, attr map[string]string) {
-	if err := t.graph.AddNode(t.graph.Name, name, attr); err != nil {
-		panic(err)
+	defaults := merge(merge(t.opts.Theme.nodeAttrs(t.kind), t.opts.NodeAttrs), t.text.attrs(t.opts.SourceURL))
+	if strings.HasPrefix(attr[attrLabel], "<") {
+		defaults = merge(defaults, htmlNodeAttrs)
+	}
+	if err := t.graph.AddNode(t.parent, name, merge(defaults, attr)); err != nil {
+		t.fail(&GraphError{Path: t.pathString(), Err: err})
 	}
 }
 
-func (t *translator) addEdge(from, to string, attr map[string]string) {
-	if err := t.graph.AddEdge(from, to, true, attr); err != nil {
-		panic(err)
+// addEdge adds the edge, which leaves from the port of the from node if it is not empty, to a node of the kind
+// with the attributes, which override Options.EdgeAttrs and the Theme style of the kind.
+func (t *translator) addEdge(from, port, to, kind string, attr map[string]string) {
+	if err := t.graph.AddPortEdge(from, port, to, "", true, merge(merge(t.opts.Theme.edgeAttrs(kind), t.opts.EdgeAttrs), attr)); err != nil {
+		t.fail(&GraphError{Path: t.pathString(), Err: err})
+	}
+}
+
+// fail records the first error, after which the translation stops descending.
+func (t *translator) fail(err error) {
+	if t.err == nil {
+		t.err = err
+	}
+}
+
+// pathString returns the path from the ast.Grammar to the current node,
+// for example Grammar.PatternDecls[2].Pattern.Or.LeftPattern
+func (t *translator) pathString() string {
+	return strings.Join(t.path, ".")
+}
+
+// index returns the name of the i'th element of a repeated field.
+func index(field string, i int) string {
+	return field + "[" + strconv.Itoa(i) + "]"
+}
+
+// merge returns the union of the attributes, where attrs override the defaults.
+func merge(defaults, attrs map[string]string) map[string]string {
+	if len(defaults) == 0 {
+		return attrs
+	}
+	m := make(map[string]string, len(defaults)+len(attrs))
+	for k, v := range defaults {
+		m[k] = v
+	}
+	for k, v := range attrs {
+		m[k] = v
 	}
+	return m
 }
 
 type label struct {
-	b *strings.Builder
+	b         *strings.Builder
+	verbosity LabelVerbosity
+	html      bool
+	// ports holds the fields which have a port in the html label.
+	ports map[string]bool
 }
 
-func newLabel(name string) *label {
+func newLabel(name string, verbosity LabelVerbosity, html bool) *label {
 	b := &strings.Builder{}
+	if html {
+		b.WriteString(`<<table border="0" cellborder="1" cellspacing="0" cellpadding="4">`)
+		b.WriteString(`<tr><td colspan="2"><b>` + name + `</b></td></tr>`)
+		return &label{b, verbosity, html, make(map[string]bool)}
+	}
 	b.WriteString(`"`)
 	b.WriteString(name)
-	return &label{b}
+	return &label{b, verbosity, html, nil}
+}
+
+// field lists a struct field and its value under the type name.
+func (l *label) field(name, value string) {
+	if l.verbosity == TypeLabels {
+		return
+	}
+	if l.html {
+		l.b.WriteString(`<tr><td align="left"` + l.port(name) + `>` + name + `</td><td align="left">` + htmlText(value) + `</td></tr>`)
+		return
+	}
+	l.b.WriteString(`\n`)
+	l.b.WriteString(name)
+	l.b.WriteString(`: `)
+	l.b.WriteString(escape(value))
+}
+
+// quoted lists a struct field with a quoted value, such as whitespace,
+// where the newlines, tabs and other special characters are shown as Go escapes.
+func (l *label) quoted(name, value string) {
+	l.field(name, strconv.Quote(value))
 }
 
-func (l *label) write(ss ...string) {
-	for _, s := range ss {
-		l.b.WriteString(s)
+// child lists a struct field which is drawn as an edge to a child node.
+// In an html label the row of the field is a port, from which the edge to the child leaves,
+// so the row is also listed for ValueLabels.
+func (l *label) child(name string) {
+	if l.html && l.verbosity != TypeLabels {
+		l.b.WriteString(`<tr><td colspan="2"` + l.port(name) + `>` + name + `</td></tr>`)
+		return
+	}
+	if l.verbosity != FieldLabels {
+		return
 	}
+	l.field(name, name)
 }
 
 func (l *label) finish() string {
+	if l.html {
+		l.b.WriteString(`</table>>`)
+		return l.b.String()
+	}
 	l.b.WriteString(`"`)
 	return l.b.String()
 }
 
-func WriteSVG(graph *gographviz.Graph, w io.Writer) error {
-	pp := svg.MassageDotSVG()
-	return pp(bytes.NewReader([]byte(graph.String())), w)
+// port returns the port attribute of a table cell for the field,
+// which is left out for the elements of repeated fields, such as Space[0].
+func (l *label) port(field string) string {
+	if strings.ContainsAny(field, "[]") {
+		return ""
+	}
+	l.ports[field] = true
+	return ` port="` + field + `"`
+}
+
+var htmlNodeAttrs = map[string]string{
+	string(gographviz.Shape):  "none",
+	string(gographviz.Margin): "0",
 }
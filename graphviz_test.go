@@ -15,9 +15,23 @@
 package relapseviz
 
 import (
-	"fmt"
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/awalterschulze/gographviz"
+	"github.com/jmarais/relapseviz/automaton"
+	"github.com/jmarais/relapseviz/internal/graphviztest"
+	"github.com/jmarais/relapseviz/svg"
+	"github.com/katydid/katydid/parser/json"
+	"github.com/katydid/katydid/relapse"
 )
 
 // var tt = `(.WhatsUp: == "F" &.Survived: >= 1000000/*years*/ &
@@ -50,22 +64,601 @@ var tt = `
 `
 
 func TestTranslate(t *testing.T) {
-	graph, err := Translate(tt, true)
+	graph, err := Translate(tt, Options{Keywords: true, Spaces: true})
 	if err != nil {
 		t.Fatal(err)
 	}
-	fmt.Printf("Nodes:\n")
-	for n := range graph.Nodes.Lookup {
-		fmt.Printf("%v\n", n)
+	if len(graph.Nodes.Nodes) == 0 || len(graph.Edges.Edges) == 0 {
+		t.Fatalf("expected nodes and edges, but got %d nodes and %d edges", len(graph.Nodes.Nodes), len(graph.Edges.Edges))
 	}
-	fmt.Printf("Edges:\n")
 	for _, e := range graph.Edges.Edges {
-		fmt.Printf("%v -> %v\n", e.Src, e.Dst)
+		if _, ok := graph.Nodes.Lookup[e.Src]; !ok {
+			t.Fatalf("expected the source of the edge %s -> %s to be a node", e.Src, e.Dst)
+		}
+		if _, ok := graph.Nodes.Lookup[e.Dst]; !ok {
+			t.Fatalf("expected the destination of the edge %s -> %s to be a node", e.Src, e.Dst)
+		}
+	}
+	dot := graph.String()
+	for _, name := range []string{"WhatsUp", "Survived", "DragonsExist", "MonkeysSmart", "History", "FeatureRequests", "Anatomy"} {
+		if !strings.Contains(dot, name) {
+			t.Fatalf("expected the field %s in the graph:\n%s", name, dot)
+		}
+	}
+	read, err := gographviz.Read([]byte(dot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Nodes.Nodes) != len(graph.Nodes.Nodes) || len(read.Edges.Edges) != len(graph.Edges.Edges) {
+		t.Fatalf("expected the dot output to be read back as the same graph:\n%s", dot)
+	}
+	buf := new(bytes.Buffer)
+	if err := (Renderer{BuiltinLayout: true}).WriteSVG(graph, buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Count(buf.String(), `class="node"`), len(graph.Nodes.Nodes); got != want {
+		t.Fatalf("expected %d nodes in the svg, but got %d", want, got)
+	}
+}
+
+func TestUnknownNode(t *testing.T) {
+	tr := newTranslator(Options{})
+	tr.path = []string{"Grammar", "TopPattern"}
+	tr.translate(struct{}{}, "Unknown")
+	err, ok := tr.err.(*UnknownNodeError)
+	if !ok {
+		t.Fatalf("expected an UnknownNodeError, but got %v", tr.err)
+	}
+	if err.Path != "Grammar.TopPattern" {
+		t.Fatalf("expected the path Grammar.TopPattern, but got %s", err.Path)
+	}
+}
+
+func TestGraphError(t *testing.T) {
+	_, err := Translate(tt, Options{NodeAttrs: map[string]string{"notanattribute": "true"}})
+	gerr, ok := err.(*GraphError)
+	if !ok {
+		t.Fatalf("expected a GraphError, but got %v", err)
+	}
+	if gerr.Path != "Grammar" {
+		t.Fatalf("expected the path Grammar, but got %s", gerr.Path)
+	}
+}
+
+func TestPathIDs(t *testing.T) {
+	graph, err := Translate(tt, Options{IDs: PathIDs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{`"Grammar"`, `"Grammar.TopPattern"`, `"Grammar.TopPattern.And"`} {
+		if _, ok := graph.Nodes.Lookup[id]; !ok {
+			t.Fatalf("expected node %s", id)
+		}
+	}
+}
+
+func TestHashIDsAreStable(t *testing.T) {
+	before, err := Translate("#main = .A: @b\n#b = .B: *", Options{IDs: HashIDs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := Translate("#main = .A: @b\n#a = .C: *\n#b = .B: *", Options{IDs: HashIDs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := range before.Nodes.Lookup {
+		if _, ok := after.Nodes.Lookup[id]; !ok {
+			t.Fatalf("node %s moved after inserting a pattern declaration", id)
+		}
+	}
+}
+
+func TestReferences(t *testing.T) {
+	graph, err := Translate("#main = .A: @b\n#b = .B: @b", Options{References: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	styles := make(map[string]int)
+	for _, e := range graph.Edges.Edges {
+		if e.Attrs[gographviz.Style] == "dashed" {
+			styles[e.Attrs[gographviz.Color]]++
+		}
+	}
+	if styles["blue"] != 1 || styles["red"] != 1 {
+		t.Fatalf("expected one reference and one recursive reference edge, but got %v", styles)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	graph, err := Translate(tt, Options{Compact: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range graph.Nodes.Nodes {
+		if n.Attrs[gographviz.Label] == `"Pattern"` {
+			t.Fatalf("expected the Pattern wrappers to be elided")
+		}
+		if n.Attrs[gographviz.Label] == `"|"` {
+			if len(graph.Edges.SrcToDsts[n.Name]) != 3 {
+				t.Fatalf("expected the chain of ors to be flattened into three operands, but got %v", graph.Edges.SrcToDsts[n.Name])
+			}
+		}
+	}
+}
+
+func TestClusters(t *testing.T) {
+	graph, err := Translate("#main = .A: @b\n#b = .B: *", Options{Clusters: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"cluster_main", "cluster_b"} {
+		if !graph.IsSubGraph(name) {
+			t.Fatalf("expected subgraph %s", name)
+		}
+		if len(graph.Relations.ParentToChildren[name]) == 0 {
+			t.Fatalf("expected nodes inside subgraph %s", name)
+		}
+	}
+}
+
+func TestMermaid(t *testing.T) {
+	for _, test := range []struct {
+		opts  Options
+		wants []string
+	}{
+		{Options{Compact: true, Clusters: true, References: true}, []string{"subgraph cluster_main", "-.->"}},
+		{Options{}, []string{`-->|"Pattern"|`}},
+	} {
+		graph, err := Translate("#main = (.A == \"x|y\" & .B: {*}) | @b\n#b = .C: *", test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := &bytes.Buffer{}
+		if err := WriteMermaid(graph, buf); err != nil {
+			t.Fatal(err)
+		}
+		out := buf.String()
+		if !strings.HasPrefix(out, "flowchart TD\n") {
+			t.Fatalf("expected a flowchart, but got %s", out)
+		}
+		for _, line := range strings.Split(out, "\n") {
+			i := strings.Index(line, `["`)
+			if i < 0 {
+				continue
+			}
+			if label := strings.TrimSuffix(line[i+2:], `"]`); strings.ContainsAny(label, `"|&{}`) {
+				t.Fatalf("expected the label to be escaped, but got %s", line)
+			}
+		}
+		for _, want := range test.wants {
+			if !strings.Contains(out, want) {
+				t.Fatalf("expected %q in %s", want, out)
+			}
+		}
 	}
-	fmt.Printf("Graph:\n%v\n", graph.String())
-	f, _ := os.Create("relapse.svg")
-	err = WriteSVG(graph, f)
+}
+
+func TestTranslateTrace(t *testing.T) {
+	g, err := relapse.Parse(`.A == "x"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := json.NewJsonParser()
+	if err := p.Init([]byte(`{"A":"y"}`)); err != nil {
+		t.Fatal(err)
+	}
+	frames, err := TranslateTrace(g, p, Options{Compact: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := frames[len(frames)-1]
+	if !strings.HasSuffix(last.Label, "(invalid)") {
+		t.Fatalf("expected the last frame to be invalid, but got %s", last.Label)
+	}
+	for _, f := range frames {
+		if !strings.Contains(f.Graph.Attrs[gographviz.Label], "an approximation of katydid") {
+			t.Fatalf("expected frame %s to be labelled as an approximation, but got %s", f.Label, f.Graph.Attrs[gographviz.Label])
+		}
+	}
+	buf := new(bytes.Buffer)
+	if err := WriteTraceHTML(frames, buf); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "<iframe"); n != len(frames) {
+		t.Fatalf("expected %d frames in the html, but got %d", len(frames), n)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	g, err := relapse.Parse(`(.A: * | .B: *)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := json.NewJsonParser()
+	if err := p.Init([]byte(`{"A":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	r, err := automaton.Match(g, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := TranslateGrammar(g, Options{Compact: true, Match: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	colors := make(map[string]string)
+	for _, n := range graph.Nodes.Nodes {
+		colors[n.Attrs[gographviz.Label]] = n.Attrs[gographviz.FillColor]
+	}
+	if colors[`".A:"`] != matchColors[automaton.Matched] {
+		t.Fatalf("expected .A: to be colored as matched, but got %q", colors[`".A:"`])
+	}
+	if colors[`".B:"`] != matchColors[automaton.Reached] {
+		t.Fatalf("expected .B: to be left as reached, but got %q", colors[`".B:"`])
+	}
+	graph, err = TranslateGrammar(g, Options{Compact: true, Match: r, Theme: LightTheme()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range graph.Nodes.Nodes {
+		if n.Attrs[gographviz.Label] == `".A:"` && n.Attrs[gographviz.Style] != `"rounded,filled"` {
+			t.Fatalf("expected the matched .A: to keep the rounded style of the theme, but got %s", n.Attrs[gographviz.Style])
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old, err := relapse.Parse("(.A: * | .B: *)\n#x = .X: *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := relapse.Parse("(.A: * | .C: *)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, changes, err := Diff(old, new, Options{Compact: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := make(map[ChangeKind]int)
+	for _, c := range changes {
+		kinds[c.Kind]++
+		if c.Kind == Changed && (c.Old != ".B:" || c.New != ".C:") {
+			t.Fatalf("expected .B: to change to .C:, but got %v", c)
+		}
+	}
+	if kinds[Added] != 0 || kinds[Removed] != 1 || kinds[Changed] != 1 {
+		t.Fatalf("expected a removed and a changed node, but got %v", changes)
+	}
+	colors := make(map[string]string)
+	for _, n := range graph.Nodes.Nodes {
+		colors[n.Attrs[gographviz.Label]] = n.Attrs[gographviz.FillColor]
+	}
+	if colors[`".C:"`] != diffColors[Changed] {
+		t.Fatalf("expected .C: to be colored as changed, but got %q", colors[`".C:"`])
+	}
+	if colors[`".X:"`] != diffColors[Removed] {
+		t.Fatalf("expected .X: to be colored as removed, but got %q", colors[`".X:"`])
+	}
+	if colors[`".A:"`] != "" {
+		t.Fatalf("expected .A: to be left uncolored, but got %q", colors[`".A:"`])
+	}
+}
+
+func TestFocus(t *testing.T) {
+	g, err := relapse.Parse("@a\n#a = (.A: @b | .X: *)\n#b = .B: @c\n#c = .C: *")
 	if err != nil {
 		t.Fatal(err)
 	}
+	for depth, want := range map[int][]string{0: {".A:"}, 1: {".A:", ".B:"}, -1: {".A:", ".B:", ".C:"}} {
+		graph, err := TranslateGrammar(g, Options{Compact: true, Focus: "a", FocusDepth: depth})
+		if err != nil {
+			t.Fatal(err)
+		}
+		labels := make(map[string]bool)
+		for _, n := range graph.Nodes.Nodes {
+			labels[unquoteDot(n.Attrs[gographviz.Label])] = true
+		}
+		if len(want) < 3 && labels[".C:"] || labels["@a"] {
+			t.Fatalf("depth %d: expected only the focused declarations, but got %v", depth, labels)
+		}
+		for _, label := range want {
+			if !labels[label] {
+				t.Fatalf("depth %d: expected %s, but got %v", depth, label, labels)
+			}
+		}
+	}
+	if _, err := TranslateGrammar(g, Options{Focus: "d"}); err == nil {
+		t.Fatal("expected an error for an undeclared pattern")
+	} else if _, ok := err.(*UnknownPatternError); !ok {
+		t.Fatalf("expected an *UnknownPatternError, but got %T", err)
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	g, err := relapse.Parse(`a: b: c: d: *`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := TranslateGrammar(g, Options{Compact: true, MaxDepth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := make(map[string]bool)
+	for _, n := range graph.Nodes.Nodes {
+		labels[unquoteDot(n.Attrs[gographviz.Label])] = true
+	}
+	want := "…\n2 hidden nodes\nc: d: *"
+	if !labels["a:"] || !labels["b:"] || labels["c:"] || !labels[want] {
+		t.Fatalf("expected c: to be collapsed into %q, but got %v", want, labels)
+	}
+}
+
+func TestHidden(t *testing.T) {
+	g, err := relapse.Parse(tt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []Options{{}, {Keywords: true}, {Compact: true}} {
+		graph, err := TranslateGrammar(g, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the Grammar and the TopPattern are not hidden below the TopPattern
+		var top interface{} = g.TopPattern
+		if opts.Compact {
+			top, _ = unwrap(g.TopPattern)
+		}
+		tr := newTranslator(opts)
+		if got, want := tr.hidden(top), len(graph.Nodes.Nodes)-2; got != want || tr.err != nil {
+			t.Fatalf("%+v: expected %d hidden nodes, but got %d and %v", opts, want, got, tr.err)
+		}
+	}
+}
+
+func TestTheme(t *testing.T) {
+	g, err := relapse.Parse(`(A: * | B: @b)
+#b = *`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := TranslateGrammar(g, Options{Compact: true, Theme: LightTheme()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shapes := make(map[string]string)
+	for _, n := range graph.Nodes.Nodes {
+		shapes[n.Attrs[gographviz.Label]] = n.Attrs[gographviz.Shape]
+	}
+	if shapes[`"A:"`] != `"box"` || shapes[`"|"`] != `"diamond"` {
+		t.Fatalf("expected the TreeNode and Or nodes to be styled by the theme, but got %v", shapes)
+	}
+	if graph.Attrs[gographviz.BgColor] != `"white"` {
+		t.Fatalf("expected the background of the theme, but got %q", graph.Attrs[gographviz.BgColor])
+	}
+
+	f, err := ioutil.TempFile("", "theme*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(`{"kinds": {"Reference": {"shape": "box", "fillcolor": "pink"}}}`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	theme, err := LoadTheme(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := theme.Kinds["Reference"]; s.Shape != "box" || s.FillColor != "pink" {
+		t.Fatalf("expected the Reference style from the file, but got %+v", s)
+	}
+
+	light, err := LoadTheme("light")
+	if err != nil {
+		t.Fatal(err)
+	}
+	light.Graph["bgcolor"] = "black"
+	light.Kinds["TreeNode"] = Style{Shape: "circle"}
+	if again, err := LoadTheme("light"); err != nil || !reflect.DeepEqual(again, LightTheme()) {
+		t.Fatalf("expected the built-in theme to be unchanged, but got %+v and %v", again, err)
+	}
+}
+
+func TestHTMLLabels(t *testing.T) {
+	graph, err := Translate(`(A: * | B: *)`, Options{HTMLLabels: true, IDs: PathIDs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	or := graph.Nodes.Lookup[`"Grammar.TopPattern.Or"`]
+	if or == nil {
+		t.Fatal("expected an Or node")
+	}
+	if l := or.Attrs[gographviz.Label]; !strings.HasPrefix(l, "<<table") || !strings.Contains(l, `port="LeftPattern"`) {
+		t.Fatalf("expected an html table with a LeftPattern port, but got %s", l)
+	}
+	ports := make(map[string]bool)
+	for _, e := range graph.Edges.SrcToDsts[or.Name] {
+		for _, edge := range e {
+			ports[edge.SrcPort] = true
+		}
+	}
+	if !ports["LeftPattern"] || !ports["RightPattern"] {
+		t.Fatalf("expected the edges to leave from the LeftPattern and RightPattern rows, but got %v", ports)
+	}
+	if text := labelText(or.Attrs[gographviz.Label]); !strings.HasPrefix(text, "Or\nOpenParen: (") {
+		t.Fatalf("expected the rows of the table as lines, but got %q", text)
+	}
+}
+
+func TestSources(t *testing.T) {
+	graph, err := Translate("(A: * &\nB: *)", Options{Compact: true, Sources: true, SourceURL: "g.relapse", IDs: PathIDs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := graph.Nodes.Lookup[`"Grammar.TopPattern.And.RightPattern.TreeNode"`]
+	if b == nil {
+		t.Fatal("expected a TreeNode node")
+	}
+	for attr, want := range map[gographviz.Attr]string{
+		gographviz.Tooltip: `"2:1\nB: *"`,
+		gographviz.Comment: `"2:1-2:4"`,
+		gographviz.URL:     `"g.relapse#L2"`,
+	} {
+		if got := b.Attrs[attr]; got != want {
+			t.Fatalf("expected %s %s, but got %s", attr, want, got)
+		}
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	graph, err := Translate(`(A: * | B: *)`, Options{Compact: true, Sources: true, IDs: PathIDs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := WriteHTML(graph, buf); err != nil {
+		t.Fatal(err)
+	}
+	page := buf.String()
+	for _, want := range []string{`<svg`, `id="viewport"`, `"name":"Grammar.TopPattern.Or.LeftPattern.TreeNode"`, `"source":"1:2\nA: *"`} {
+		if !strings.Contains(page, want) {
+			t.Fatalf("expected the page to contain %s", want)
+		}
+	}
+	if strings.Contains(page, "SVGPan") {
+		t.Fatal("expected the page to pan the svg itself, without the SVGPan script")
+	}
+}
+
+func TestWriteSVGContext(t *testing.T) {
+	graph := gographviz.NewGraph()
+	if err := graph.SetName("G"); err != nil {
+		t.Fatal(err)
+	}
+	path := graphviztest.Fake(t, `echo "Warning: still laying out" >&2; exec sleep 10`)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer os.Setenv("GRAPHVIZ_DOT", os.Getenv("GRAPHVIZ_DOT"))
+	os.Setenv("GRAPHVIZ_DOT", path)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	buf := new(bytes.Buffer)
+	err := WriteSVGContext(ctx, graph, buf)
+	var failed *svg.GraphvizError
+	if !errors.As(err, &failed) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a GraphvizError for the deadline, but got %#v", err)
+	}
+	if failed.Stderr != "Warning: still laying out" {
+		t.Fatalf("expected the stderr of graphviz, but got %q", failed.Stderr)
+	}
+	if buf.Len() != 0 {
+		t.Fatal("expected nothing to be written")
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := (Renderer{BuiltinLayout: true}).WriteSVGContext(ctx, graph, buf); err != context.Canceled {
+		t.Fatalf("expected the built-in layout to return the error of the context, but got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatal("expected nothing to be written")
+	}
+}
+
+func TestRendererGraphviz(t *testing.T) {
+	r := Renderer{DPI: 300, Size: "7.5,10!", Graphviz: svg.Graphviz{GraphAttrs: map[string]string{"splines": "ortho"}}}
+	want := map[string]string{"dpi": "300", "size": "7.5,10!", "splines": "ortho"}
+	if got := r.graphviz().GraphAttrs; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, but got %v", want, got)
+	}
+	if len(r.Graphviz.GraphAttrs) != 1 {
+		t.Fatal("expected the attributes of the renderer to be left as they are")
+	}
+}
+
+func TestWritePNG(t *testing.T) {
+	graph := gographviz.NewGraph()
+	if err := graph.SetName("G"); err != nil {
+		t.Fatal(err)
+	}
+	// the fake binary writes its arguments instead of a png
+	path := graphviztest.Fake(t, `echo "$@"`)
+	defer os.RemoveAll(filepath.Dir(path))
+	buf := new(bytes.Buffer)
+	r := Renderer{DPI: 300, Size: "7.5,10!", Graphviz: svg.Graphviz{Path: path}}
+	if err := r.WritePNG(graph, buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.TrimSpace(buf.String()), "-Tpng -Gdpi=300 -Gsize=7.5,10!"; got != want {
+		t.Fatalf("expected graphviz to be invoked with %s, but got %s", want, got)
+	}
+	path = graphviztest.Fake(t, `echo "half a png"; exit 1`)
+	defer os.RemoveAll(filepath.Dir(path))
+	buf.Reset()
+	err := Renderer{Graphviz: svg.Graphviz{Path: path}}.WritePNG(graph, buf)
+	var failed *svg.GraphvizError
+	if !errors.As(err, &failed) {
+		t.Fatalf("expected a GraphvizError, but got %#v", err)
+	}
+	if buf.Len() > 0 {
+		t.Fatalf("expected nothing to be written when graphviz fails, but got %q", buf.String())
+	}
+}
+
+func TestEscape(t *testing.T) {
+	for s, want := range map[string]string{
+		`say "hi"`:     `say \"hi\"`,
+		`a\b`:          `a\\b`,
+		"a\nb":         `a\nb`,
+		"\t\x00\xff ✓": `\\t\\x00\\xff ✓`,
+	} {
+		if got := escape(s); got != want {
+			t.Fatalf("escape(%q) = %s, want %s", s, got, want)
+		}
+	}
+}
+
+var escapeOptions = []Options{
+	{Keywords: true, Spaces: true},
+	{Keywords: true, Spaces: true, HTMLLabels: true},
+	{Compact: true, Clusters: true, IDs: NamedPathIDs},
+}
+
+// translatesToDot asserts that the relapse source translates to dot which gographviz can parse back,
+// for every set of escapeOptions.
+func translatesToDot(t *testing.T, src string) {
+	for _, opts := range escapeOptions {
+		graph, err := Translate(src, opts)
+		if err != nil {
+			t.Fatalf("%+v: %v", opts, err)
+		}
+		if _, err := gographviz.Read([]byte(graph.String())); err != nil {
+			t.Fatalf("%+v: %v\n%s", opts, err, graph.String())
+		}
+	}
+}
+
+var escapeSources = []string{
+	tt,
+	`/* "quoted\" */ a == "say \"hi\"\\" & b == "line\nbreak\ttab" & c == "\xff\x00"`,
+	`d == []byte{0x22, 0x5c, 0x0a, 0xff} // }"\`,
+	`@ab
+	#ab = ("x\"y": * | _ == "<b>&</b>")`,
+}
+
+func TestEscapeLabels(t *testing.T) {
+	for _, src := range escapeSources {
+		translatesToDot(t, src)
+	}
+}
+
+func FuzzTranslate(f *testing.F) {
+	for _, src := range escapeSources {
+		f.Add(src)
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		if _, err := relapse.Parse(src); err != nil {
+			t.Skip()
+		}
+		translatesToDot(t, src)
+	})
 }
@@ -0,0 +1,42 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package graphviztest provides a fake Graphviz binary for the tests of relapseviz and its svg package.
+package graphviztest
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// Fake writes a shell script named dot, which stands in for the Graphviz binary, into a new temporary directory
+// and returns its path, where the caller removes the directory.
+// The test is skipped on windows, where the script cannot be run.
+func Fake(t testing.TB, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake Graphviz binary is a shell script")
+	}
+	dir, err := ioutil.TempDir("", "graphviz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "dot")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
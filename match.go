@@ -0,0 +1,50 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package relapseviz
+
+import (
+	"github.com/awalterschulze/gographviz"
+	"github.com/jmarais/relapseviz/automaton"
+)
+
+// matchColors are the fill colors of the TreeNode and LeafNode nodes for every status of Options.Match,
+// where reached nodes, which neither matched nor failed, are left as they are.
+var matchColors = map[automaton.Status]string{
+	automaton.Unreached: "lightgrey",
+	automaton.Matched:   "palegreen",
+	automaton.Failed:    "lightcoral",
+}
+
+// matched adds the fill color of the status of the TreeNode or LeafNode in Options.Match to the node attributes,
+// where filled is added to the style of the node.
+func (t *translator) matched(node interface{}, attrs map[string]string) map[string]string {
+	if t.opts.Match == nil {
+		return attrs
+	}
+	color, ok := matchColors[t.opts.Match.Status(node)]
+	if !ok {
+		return attrs
+	}
+	style := string(gographviz.Style)
+	if _, ok := attrs[style]; !ok {
+		// the style of the theme or Options.NodeAttrs, such as rounded, is kept
+		if s, ok := merge(t.opts.Theme.nodeAttrs(t.kind), t.opts.NodeAttrs)[style]; ok {
+			attrs[style] = s
+		}
+	}
+	addStyle(attrs, "filled")
+	attrs[string(gographviz.FillColor)] = color
+	return attrs
+}
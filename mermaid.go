@@ -0,0 +1,183 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package relapseviz
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+// WriteMermaid writes the graph as a mermaid flowchart, which is rendered natively in markdown by many platforms.
+// The flowchart keeps the node labels and edge names of the graph,
+// clusters become subgraphs and dashed edges, such as references, become dotted links.
+// The direction of the flowchart follows the rankdir of the graph and is TD by default.
+func WriteMermaid(graph *gographviz.Graph, w io.Writer) error {
+	m := &mermaid{
+		graph: graph,
+		w:     bufio.NewWriter(w),
+		ids:   make(map[string]string),
+	}
+	for i, n := range graph.Nodes.Nodes {
+		m.ids[n.Name] = fmt.Sprintf("n%d", i)
+	}
+	fmt.Fprintf(m.w, "flowchart %s\n", mermaidDirection(graph.Attrs[gographviz.RankDir]))
+	m.subgraph(graph.Name, "    ")
+	m.edges()
+	m.styles()
+	return m.w.Flush()
+}
+
+type mermaid struct {
+	graph *gographviz.Graph
+	w     *bufio.Writer
+	ids   map[string]string
+}
+
+func mermaidDirection(rankdir string) string {
+	switch unquoteDot(rankdir) {
+	case "LR", "RL", "BT":
+		return unquoteDot(rankdir)
+	}
+	return "TD"
+}
+
+// subgraph writes the nodes directly inside the parent graph, followed by its nested subgraphs,
+// where the nodes and subgraphs are written in the order in which they were added.
+func (m *mermaid) subgraph(parent string, indent string) {
+	var subgraphs []string
+	seen := make(map[string]bool)
+	for _, n := range m.graph.Nodes.Nodes {
+		p := m.parentOf(n.Name)
+		if p == parent {
+			fmt.Fprintf(m.w, "%s%s[\"%s\"]\n", indent, m.ids[n.Name], nodeLabel(n))
+			continue
+		}
+		// find the subgraph directly inside parent which holds the node
+		for p != "" && p != m.graph.Name && m.parentOf(p) != parent {
+			p = m.parentOf(p)
+		}
+		if p != "" && p != m.graph.Name && !seen[p] {
+			seen[p] = true
+			subgraphs = append(subgraphs, p)
+		}
+	}
+	for _, s := range subgraphs {
+		label := unquoteDot(s)
+		if l, ok := m.graph.SubGraphs.SubGraphs[s].Attrs[gographviz.Label]; ok {
+			label = unquoteDot(l)
+		}
+		fmt.Fprintf(m.w, "%ssubgraph %s [\"%s\"]\n", indent, mermaidId(s), mermaidEscape(label))
+		m.subgraph(s, indent+"    ")
+		fmt.Fprintf(m.w, "%send\n", indent)
+	}
+}
+
+// parentOf returns the graph or subgraph which holds the node or subgraph.
+func (m *mermaid) parentOf(name string) string {
+	for p := range m.graph.Relations.ChildToParents[name] {
+		return p
+	}
+	return ""
+}
+
+func (m *mermaid) edges() {
+	for _, e := range m.graph.Edges.Edges {
+		dotted := strings.Contains(e.Attrs[gographviz.Style], "dashed") || strings.Contains(e.Attrs[gographviz.Style], "dotted")
+		var arrow string
+		switch {
+		case dotted && e.Dir:
+			arrow = "-.->"
+		case dotted:
+			arrow = "-.-"
+		case e.Dir:
+			arrow = "-->"
+		default:
+			arrow = "---"
+		}
+		if l, ok := e.Attrs[gographviz.Label]; ok {
+			arrow += `|"` + mermaidEscape(unquoteDot(l)) + `"|`
+		}
+		fmt.Fprintf(m.w, "    %s %s %s\n", m.ids[e.Src], arrow, m.ids[e.Dst])
+	}
+}
+
+// styles writes the colors of the nodes and edges.
+func (m *mermaid) styles() {
+	for _, n := range m.graph.Nodes.Nodes {
+		var ss []string
+		if c, ok := n.Attrs[gographviz.FillColor]; ok && strings.Contains(n.Attrs[gographviz.Style], "filled") {
+			ss = append(ss, "fill:"+unquoteDot(c))
+		}
+		if c, ok := n.Attrs[gographviz.Color]; ok {
+			ss = append(ss, "stroke:"+unquoteDot(c))
+		}
+		if c, ok := n.Attrs[gographviz.FontColor]; ok {
+			ss = append(ss, "color:"+unquoteDot(c))
+		}
+		if len(ss) > 0 {
+			fmt.Fprintf(m.w, "    style %s %s\n", m.ids[n.Name], strings.Join(ss, ","))
+		}
+	}
+	for i, e := range m.graph.Edges.Edges {
+		if c, ok := e.Attrs[gographviz.Color]; ok {
+			fmt.Fprintf(m.w, "    linkStyle %d stroke:%s\n", i, unquoteDot(c))
+		}
+	}
+}
+
+// nodeLabel returns the escaped label of the node, which is its name if it has no label.
+func nodeLabel(n *gographviz.Node) string {
+	if l, ok := n.Attrs[gographviz.Label]; ok {
+		return mermaidEscape(labelText(l))
+	}
+	return mermaidEscape(unquoteDot(n.Name))
+}
+
+// mermaidId returns an identifier which mermaid accepts for the subgraph.
+func mermaidId(name string) string {
+	b := &strings.Builder{}
+	for _, r := range unquoteDot(name) {
+		if r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			b.WriteRune(r)
+			continue
+		}
+		fmt.Fprintf(b, "_%x_", r)
+	}
+	return b.String()
+}
+
+// mermaidEscape escapes the text to be used inside a quoted mermaid label.
+// Characters with a meaning in mermaid, such as the quotes, pipes and brackets found in relapse,
+// are written as entity codes and newlines become line breaks.
+func mermaidEscape(s string) string {
+	b := &strings.Builder{}
+	for _, r := range strings.TrimSuffix(s, "\n") {
+		switch r {
+		case '\n':
+			b.WriteString("<br>")
+		case '"':
+			b.WriteString("#quot;")
+		case '#', '|', '&', '{', '}', '[', ']', '(', ')', '<', '>', ';', '`', '\\':
+			fmt.Fprintf(b, "#%d;", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
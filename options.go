@@ -0,0 +1,157 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package relapseviz
+
+import (
+	"github.com/awalterschulze/gographviz"
+	"github.com/jmarais/relapseviz/automaton"
+	"github.com/katydid/katydid/relapse/ast"
+)
+
+// Options configures the translation of an ast.Grammar to a graphviz Graph.
+// The zero value only traverses the nodes which the relapse walker visits,
+// lists every struct field in the node labels and names the graph "Relapse".
+type Options struct {
+	// Keywords also traverses the Keyword nodes, such as brackets and operators.
+	Keywords bool
+	// Spaces also traverses the Space nodes, which hold whitespace and comments.
+	Spaces bool
+	// Compact translates to a semantic view which mirrors the relapse syntax,
+	// where the Pattern, NameExpr and Expr wrappers are elided and nodes are labelled
+	// by their operator, such as |, &, *, !, {…} and .name:
+	// Keyword and Space nodes are never traversed in the compact view.
+	Compact bool
+	// References adds an edge from every Reference to the PatternDecl it refers to,
+	// where the edges which are part of a recursive cycle are highlighted.
+	References bool
+	// Clusters draws the nodes of every PatternDecl inside its own subgraph named cluster_<name>,
+	// where the nodes of the TopPattern are drawn inside cluster_main.
+	Clusters bool
+	// Labels selects how much of an ast node is listed in its label.
+	Labels LabelVerbosity
+	// HTMLLabels draws the labels as graphviz html-like tables, with the type name as the header row and a row per field,
+	// where the edges to the children leave from the row of their field, such as LeftPattern.
+	// It is ignored by the compact view.
+	HTMLLabels bool
+	// Name is the name of the graph, "Relapse" when empty.
+	Name string
+	// RankDir is the graphviz rankdir of the graph, for example "LR".
+	RankDir string
+	// Layout is the Graphviz layout engine of the graph, such as dot, neato, fdp, sfdp, twopi or circo,
+	// which is written as its layout attribute, so that Graphviz uses it instead of its default engine.
+	// The built-in layout ignores it.
+	Layout string
+	// Focus only translates the PatternDecl with this name, or the TopPattern if it is main,
+	// to look at one piece of a large grammar at a time.
+	Focus string
+	// FocusDepth also translates the PatternDecls which the Focus references, up to this many references away,
+	// where a negative depth follows every reference.
+	FocusDepth int
+	// MaxDepth collapses the subtrees below this depth, where the ast.Grammar is at depth zero,
+	// into a single … node which shows the number of nodes it hides and the relapse source of the subtree,
+	// so that an overview of a deep grammar fits on screen. Zero draws every node.
+	MaxDepth int
+	// Sources adds the relapse source of every node, as reconstructed by the String method of the ast,
+	// as its tooltip prefixed by the line and column where it starts, and its start and end positions as its comment,
+	// so that hovering over a node in the svg shows the grammar fragment it came from.
+	Sources bool
+	// SourceURL is the URL of the relapse file, to which every node links with the fragment of its lines,
+	// such as file.relapse#L3-L5, if Sources is set.
+	SourceURL string
+	// IDs selects how node ids are generated.
+	IDs IDStrategy
+	// Seed seeds the generator of RandomIDs.
+	Seed int64
+	// GraphAttrs are extra graphviz attributes added to the graph.
+	GraphAttrs map[string]string
+	// Theme styles the nodes and the edges to them by the kind of ast node, such as LightTheme(), DarkTheme() or PrintTheme().
+	// GraphAttrs, NodeAttrs and EdgeAttrs override the theme.
+	Theme *Theme
+	// NodeAttrs are graphviz attributes added to every node.
+	NodeAttrs map[string]string
+	// EdgeAttrs are graphviz attributes added to every edge.
+	EdgeAttrs map[string]string
+	// Match colors the TreeNode and LeafNode nodes by how they took part in the validation of an input,
+	// as returned by automaton.Match, where the matched nodes are green, the nodes which caused the failure red
+	// and the nodes which were never reached grey.
+	// The statuses come from the derivatives of the automaton package, which approximate katydid's validation,
+	// where Match only checks that katydid agrees on the validity.
+	Match *automaton.Result
+}
+
+// LabelVerbosity selects how much of an ast node is listed in its label.
+type LabelVerbosity int
+
+const (
+	// FieldLabels lists every struct field under the type name.
+	FieldLabels LabelVerbosity = iota
+	// ValueLabels only lists the struct fields holding values,
+	// leaving out the fields which are drawn as edges.
+	ValueLabels
+	// TypeLabels only shows the type name.
+	TypeLabels
+)
+
+// IDStrategy selects how node ids are generated.
+// PathIDs, HashIDs and NamedPathIDs are stable between grammar revisions,
+// so that the generated dot files can be diffed.
+type IDStrategy int
+
+const (
+	// RandomIDs suffixes the ast type name with a number drawn from a generator seeded with Options.Seed.
+	RandomIDs IDStrategy = iota
+	// SequentialIDs suffixes the ast type name with the order in which the nodes are visited.
+	SequentialIDs
+	// PathIDs uses the path from the ast.Grammar to the node as its id,
+	// for example "Grammar.PatternDecls[2].Pattern.Or.LeftPattern".
+	PathIDs
+	// HashIDs suffixes the ast type name with a hash of the node's relapse source and its path,
+	// where PatternDecls are named instead of indexed, so ids do not shift when patterns are inserted.
+	// Identical siblings in repeated fields are told apart by an extra counter suffix.
+	HashIDs
+	// NamedPathIDs uses the path from the ast.Grammar to the node as its id, like PathIDs,
+	// but with PatternDecls named instead of indexed, for example "Grammar.#main.Pattern.Or.LeftPattern",
+	// so that the nodes of two revisions of a grammar line up, as in Diff.
+	NamedPathIDs
+)
+
+func (o Options) graphName() string {
+	if o.Name == "" {
+		return "Relapse"
+	}
+	return o.Name
+}
+
+func (o Options) graphAttrs() map[string]string {
+	attrs := merge(o.Theme.graphAttrs(), o.GraphAttrs)
+	if o.RankDir != "" {
+		attrs = merge(attrs, map[string]string{string(gographviz.RankDir): o.RankDir})
+	}
+	if o.Layout != "" {
+		attrs = merge(attrs, map[string]string{string(gographviz.Layout): quote(escape(o.Layout))})
+	}
+	return attrs
+}
+
+// visible returns whether the ast node is traversed.
+func (o Options) visible(node interface{}) bool {
+	switch node.(type) {
+	case *ast.Keyword:
+		return o.Keywords
+	case *ast.Space:
+		return o.Spaces
+	}
+	return true
+}
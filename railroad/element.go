@@ -0,0 +1,314 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package railroad
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	charWidth   = 7.5
+	boxHeight   = 24.0
+	boxPadding  = 10.0
+	arc         = 10.0
+	gap         = 10.0
+	labelHeight = 16.0
+	margin      = 10.0
+	endWidth    = 20.0
+	titleHeight = 24.0
+)
+
+// element is a part of a railroad diagram.
+// The track enters an element on the left and leaves it on the right at the same height.
+type element interface {
+	// size returns the width of the element and its heights above and below the track.
+	size() (w, up, down float64)
+	// draw writes the element with the track entering at x, y.
+	draw(w io.Writer, x, y float64)
+}
+
+// skip is an empty piece of track.
+type skip struct{}
+
+func (skip) size() (float64, float64, float64) { return 0, 0, 0 }
+
+func (skip) draw(io.Writer, float64, float64) {}
+
+// box is a piece of text inside a box on the track, which links to href if it is not empty.
+type box struct {
+	text  string
+	class string
+	href  string
+	w     float64
+}
+
+func newBox(text, class, href string) *box {
+	return &box{text: text, class: class, href: href, w: textWidth(text) + 2*boxPadding}
+}
+
+func (b *box) size() (float64, float64, float64) { return b.w, boxHeight / 2, boxHeight / 2 }
+
+func (b *box) draw(w io.Writer, x, y float64) {
+	if b.href != "" {
+		fmt.Fprintf(w, "<a xlink:href=\"%s\">\n", escape(b.href))
+	}
+	rounded := ""
+	if b.class == "terminal" {
+		rounded = " rx=\"10\" ry=\"10\""
+	}
+	fmt.Fprintf(w, "<rect class=\"%s\" x=\"%.2f\" y=\"%.2f\" width=\"%.2f\" height=\"%.2f\"%s/>\n", b.class, x, y-boxHeight/2, b.w, boxHeight, rounded)
+	fmt.Fprintf(w, "<text x=\"%.2f\" y=\"%.2f\">%s</text>\n", x+b.w/2, y, escape(b.text))
+	if b.href != "" {
+		fmt.Fprintf(w, "</a>\n")
+	}
+}
+
+// sequence draws its items one after the other.
+type sequence struct {
+	items       []element
+	w, up, down float64
+}
+
+func newSequence(items ...element) *sequence {
+	s := &sequence{items: items}
+	for i, item := range items {
+		w, up, down := item.size()
+		s.w += w
+		if i > 0 {
+			s.w += gap
+		}
+		s.up, s.down = max(s.up, up), max(s.down, down)
+	}
+	return s
+}
+
+func (s *sequence) size() (float64, float64, float64) { return s.w, s.up, s.down }
+
+func (s *sequence) draw(w io.Writer, x, y float64) {
+	for i, item := range s.items {
+		if i > 0 {
+			line(w, x, y, x+gap)
+			x += gap
+		}
+		item.draw(w, x, y)
+		iw, _, _ := item.size()
+		x += iw
+	}
+}
+
+// branches are items drawn below each other, where the first item is on the track.
+type branches struct {
+	items []element
+	// inner is the width of the widest item.
+	inner       float64
+	up, down    float64
+	itemOffsets []float64
+}
+
+func newBranches(items []element) branches {
+	b := branches{items: items}
+	for i, item := range items {
+		w, up, down := item.size()
+		b.inner = max(b.inner, w)
+		if i == 0 {
+			b.up, b.down = up, down
+			b.itemOffsets = append(b.itemOffsets, 0)
+			continue
+		}
+		offset := b.down + gap + up
+		b.itemOffsets = append(b.itemOffsets, offset)
+		b.down = offset + down
+	}
+	return b
+}
+
+// drawItems draws the items between x and x+inner, extending the track of the narrower items to the right.
+func (b branches) drawItems(w io.Writer, x, y float64) {
+	for i, item := range b.items {
+		iw, _, _ := item.size()
+		item.draw(w, x, y+b.itemOffsets[i])
+		line(w, x+iw, y+b.itemOffsets[i], x+b.inner)
+	}
+}
+
+// choice draws its items as branches of which only one is taken.
+type choice struct {
+	branches
+}
+
+func newChoice(items ...element) *choice {
+	return &choice{newBranches(items)}
+}
+
+func (c *choice) size() (float64, float64, float64) { return c.inner + 4*arc, c.up, c.down }
+
+func (c *choice) draw(w io.Writer, x, y float64) {
+	line(w, x, y, x+2*arc)
+	line(w, x+2*arc+c.inner, y, x+4*arc+c.inner)
+	for _, offset := range c.itemOffsets[1:] {
+		curveDown(w, x, y, y+offset)
+		curveUp(w, x+2*arc+c.inner, y+offset, y)
+	}
+	c.drawItems(w, x+2*arc, y)
+}
+
+// parallel draws its items as parallel tracks, which are all taken,
+// between two bars inside a dashed box with a label.
+type parallel struct {
+	branches
+	label string
+}
+
+func newParallel(label string, items ...element) *parallel {
+	return &parallel{newBranches(items), label}
+}
+
+func (p *parallel) size() (float64, float64, float64) {
+	return max(p.inner+4*arc, textWidth(p.label)) + 2*boxPadding, p.up + boxPadding + labelHeight, p.down + boxPadding
+}
+
+func (p *parallel) draw(w io.Writer, x, y float64) {
+	width, up, down := p.size()
+	fmt.Fprintf(w, "<rect class=\"parallel\" x=\"%.2f\" y=\"%.2f\" width=\"%.2f\" height=\"%.2f\" rx=\"6\" ry=\"6\"/>\n", x, y-up, width, up+down)
+	fmt.Fprintf(w, "<text class=\"label\" x=\"%.2f\" y=\"%.2f\">%s</text>\n", x+boxPadding/2, y-up+labelHeight/2+2, escape(p.label))
+	inner := x + (width-p.inner-4*arc)/2
+	line(w, x, y, inner+arc)
+	line(w, inner+3*arc+p.inner, y, x+width)
+	last := p.itemOffsets[len(p.itemOffsets)-1]
+	fmt.Fprintf(w, "<path class=\"bar\" d=\"M%.2f %.2fV%.2fM%.2f %.2fV%.2f\"/>\n", inner+arc, y-boxHeight/4, y+last+boxHeight/4,
+		inner+3*arc+p.inner, y-boxHeight/4, y+last+boxHeight/4)
+	for _, offset := range p.itemOffsets {
+		line(w, inner+arc, y+offset, inner+2*arc)
+		line(w, inner+2*arc+p.inner, y+offset, inner+3*arc+p.inner)
+	}
+	p.drawItems(w, inner+2*arc, y)
+}
+
+// bypass draws its item on the track with a branch above it which skips the item.
+type bypass struct {
+	item element
+}
+
+func newBypass(item element) *bypass {
+	return &bypass{item}
+}
+
+func (b *bypass) size() (float64, float64, float64) {
+	w, up, down := b.item.size()
+	return w + 4*arc, up + gap, down
+}
+
+func (b *bypass) draw(w io.Writer, x, y float64) {
+	iw, iup, _ := b.item.size()
+	top := y - iup - gap
+	curveUp(w, x, y, top)
+	line(w, x+2*arc, top, x+2*arc+iw)
+	curveDown(w, x+2*arc+iw, top, y)
+	line(w, x, y, x+2*arc)
+	b.item.draw(w, x+2*arc, y)
+	line(w, x+2*arc+iw, y, x+4*arc+iw)
+}
+
+// loop draws its item on the track with a track below it which returns to the start of the item.
+type loop struct {
+	item element
+}
+
+func newLoop(item element) *loop {
+	return &loop{item}
+}
+
+func (l *loop) size() (float64, float64, float64) {
+	w, up, down := l.item.size()
+	return w + 2*arc, up, down + gap
+}
+
+func (l *loop) draw(w io.Writer, x, y float64) {
+	iw, _, idown := l.item.size()
+	bottom := y + idown + gap
+	line(w, x, y, x+arc)
+	l.item.draw(w, x+arc, y)
+	line(w, x+arc+iw, y, x+2*arc+iw)
+	// the return track turns back below the item and rejoins the track before it
+	r, right, left := arc/2, x+arc+iw, x+arc
+	fmt.Fprintf(w, "<path d=\"M%.2f %.2fq%.2f 0 %.2f %.2fV%.2fq0 %.2f %.2f %.2fH%.2fq%.2f 0 %.2f %.2fV%.2fq0 %.2f %.2f %.2f\"/>\n",
+		right, y, r, r, r, bottom-r, r, -r, r, left, -r, -r, -r, y+r, -r, r, -r)
+}
+
+// group draws its item inside a box with a label.
+type group struct {
+	label string
+	class string
+	item  element
+}
+
+func newGroup(label, class string, item element) *group {
+	return &group{label, class, item}
+}
+
+func (g *group) size() (float64, float64, float64) {
+	w, up, down := g.item.size()
+	return max(w+2*boxPadding, textWidth(g.label)+boxPadding), max(up, boxHeight/4) + boxPadding/2 + labelHeight, max(down, boxHeight/4) + boxPadding/2
+}
+
+func (g *group) draw(w io.Writer, x, y float64) {
+	width, up, down := g.size()
+	iw, _, _ := g.item.size()
+	fmt.Fprintf(w, "<rect class=\"%s\" x=\"%.2f\" y=\"%.2f\" width=\"%.2f\" height=\"%.2f\" rx=\"4\" ry=\"4\"/>\n", g.class, x, y-up, width, up+down)
+	fmt.Fprintf(w, "<text class=\"label\" x=\"%.2f\" y=\"%.2f\">%s</text>\n", x+boxPadding/2, y-up+labelHeight/2+2, escape(g.label))
+	inner := x + (width-iw)/2
+	line(w, x, y, inner)
+	g.item.draw(w, inner, y)
+	line(w, inner+iw, y, x+width)
+}
+
+// line draws a horizontal piece of track.
+func line(w io.Writer, x1, y, x2 float64) {
+	if x2-x1 < 0.01 {
+		return
+	}
+	fmt.Fprintf(w, "<path d=\"M%.2f %.2fH%.2f\"/>\n", x1, y, x2)
+}
+
+// curveDown draws a track which curves down from y1 at x to y2 at x+2*arc.
+func curveDown(w io.Writer, x, y1, y2 float64) {
+	fmt.Fprintf(w, "<path d=\"M%.2f %.2fq%.2f 0 %.2f %.2fV%.2fq0 %.2f %.2f %.2f\"/>\n", x, y1, arc, arc, arc, y2-arc, arc, arc, arc)
+}
+
+// curveUp draws a track which curves up from y1 at x to y2 at x+2*arc.
+func curveUp(w io.Writer, x, y1, y2 float64) {
+	fmt.Fprintf(w, "<path d=\"M%.2f %.2fq%.2f 0 %.2f %.2fV%.2fq0 %.2f %.2f %.2f\"/>\n", x, y1, arc, arc, -arc, y2+arc, -arc, arc, -arc)
+}
+
+func textWidth(s string) float64 {
+	return float64(utf8.RuneCountInString(s)) * charWidth
+}
+
+func max(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func escape(s string) string {
+	b := &strings.Builder{}
+	xml.EscapeText(b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,212 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package railroad draws relapse grammars as railroad diagrams,
+// which are easier for grammar authors to read than the ast graph.
+//
+// Every PatternDecl is drawn as its own diagram, where
+// Concat is drawn as a sequence, Or as branches, ZeroOrMore as a loop with a bypass,
+// Optional as a bypass, And and Interleave as parallel tracks inside a dashed box,
+// TreeNode as a box labelled with its name and Reference as a box linking to its diagram.
+package railroad
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/katydid/katydid/relapse/ast"
+)
+
+// Diagram is the railroad diagram of a single pattern declaration.
+type Diagram struct {
+	// Name is the name of the pattern declaration, which is "main" for the TopPattern.
+	Name string
+	root element
+}
+
+// New returns a diagram for every pattern declaration in the grammar,
+// starting with the TopPattern, in the order in which they are declared.
+func New(g *ast.Grammar) []*Diagram {
+	var ds []*Diagram
+	if g.TopPattern != nil {
+		ds = append(ds, &Diagram{Name: "main", root: pattern(g.TopPattern)})
+	}
+	for _, pdecl := range g.PatternDecls {
+		ds = append(ds, &Diagram{Name: pdecl.Name, root: pattern(pdecl.Pattern)})
+	}
+	return ds
+}
+
+// WriteSVG writes the diagrams of every pattern declaration in the grammar below each other in a single svg,
+// where the references link to the diagram of the pattern they refer to.
+func WriteSVG(g *ast.Grammar, w io.Writer) error {
+	return writeSVG(w, New(g))
+}
+
+// WriteSVG writes the diagram as svg.
+func (d *Diagram) WriteSVG(w io.Writer) error {
+	return writeSVG(w, []*Diagram{d})
+}
+
+func writeSVG(output io.Writer, ds []*Diagram) error {
+	width, height := 0.0, 0.0
+	for _, d := range ds {
+		w, h := d.size()
+		width = max(width, w)
+		height += h
+	}
+	w := bufio.NewWriter(output)
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\" standalone=\"no\"?>\n")
+	fmt.Fprintf(w, "<svg width=\"%.0fpx\" height=\"%.0fpx\" viewBox=\"0 0 %.2f %.2f\" xmlns=\"http://www.w3.org/2000/svg\" xmlns:xlink=\"http://www.w3.org/1999/xlink\">\n",
+		width, height, width, height)
+	fmt.Fprint(w, style)
+	y := 0.0
+	for _, d := range ds {
+		d.draw(w, y)
+		_, h := d.size()
+		y += h
+	}
+	fmt.Fprintf(w, "</svg>\n")
+	return w.Flush()
+}
+
+const style = `<style>
+.railroad path { fill: none; stroke: #333; stroke-width: 2; }
+.railroad rect { fill: #fff; stroke: #333; stroke-width: 2; }
+.railroad rect.terminal { fill: #e8f4e8; }
+.railroad rect.reference { fill: #e8eef8; }
+.railroad rect.group { fill: none; stroke: #999; stroke-width: 1; }
+.railroad rect.parallel { fill: none; stroke: #999; stroke-width: 1; stroke-dasharray: 4,3; }
+.railroad path.bar { stroke-width: 4; }
+.railroad text { font-family: monospace; font-size: 12px; text-anchor: middle; dominant-baseline: central; }
+.railroad text.label { font-size: 11px; text-anchor: start; fill: #555; }
+.railroad text.title { font-size: 14px; font-weight: bold; text-anchor: start; }
+</style>
+`
+
+// size returns the size of the diagram, including its title and margins.
+func (d *Diagram) size() (float64, float64) {
+	w, up, down := d.root.size()
+	return w + 2*margin + 2*endWidth, titleHeight + up + down + 2*margin
+}
+
+func (d *Diagram) draw(w io.Writer, top float64) {
+	rw, up, _ := d.root.size()
+	fmt.Fprintf(w, "<g class=\"railroad\" id=\"%s\">\n", escape(anchor(d.Name)))
+	fmt.Fprintf(w, "<text class=\"title\" x=\"%.2f\" y=\"%.2f\">#%s</text>\n", margin, top+margin+titleHeight/2, escape(d.Name))
+	x, y := margin, top+margin+titleHeight+up
+	// the start and end of the track are drawn as double bars
+	fmt.Fprintf(w, "<path d=\"M%.2f %.2fv20m6 -20v20M%.2f %.2fh%.2f\"/>\n", x, y-10, x, y, endWidth)
+	d.root.draw(w, x+endWidth, y)
+	x += endWidth + rw
+	fmt.Fprintf(w, "<path d=\"M%.2f %.2fh%.2fM%.2f %.2fv20m6 -20v20\"/>\n", x, y, endWidth, x+endWidth-6, y-10)
+	fmt.Fprintf(w, "</g>\n")
+}
+
+// anchor returns the id of the diagram of the named pattern declaration.
+func anchor(name string) string {
+	return "railroad-" + name
+}
+
+// pattern returns the element which draws the pattern.
+func pattern(p *ast.Pattern) element {
+	switch {
+	case p == nil:
+		return skip{}
+	case p.Empty != nil:
+		return skip{}
+	case p.TreeNode != nil:
+		return newGroup(source(p.TreeNode.Name)+":", "group", pattern(p.TreeNode.Pattern))
+	case p.LeafNode != nil:
+		return newBox(source(p.LeafNode.Expr), "terminal", "")
+	case p.Concat != nil:
+		return newSequence(operands(p, concat)...)
+	case p.Or != nil:
+		return newChoice(operands(p, or)...)
+	case p.And != nil:
+		return newParallel("all of", operands(p, and)...)
+	case p.ZeroOrMore != nil:
+		return newBypass(newLoop(pattern(p.ZeroOrMore.Pattern)))
+	case p.Reference != nil:
+		return newBox("@"+p.Reference.Name, "reference", "#"+anchor(p.Reference.Name))
+	case p.Not != nil:
+		return newGroup("not", "group", pattern(p.Not.Pattern))
+	case p.ZAny != nil:
+		return newBox("*", "terminal", "")
+	case p.Contains != nil:
+		if inner := p.Contains.Pattern; inner != nil && inner.TreeNode != nil {
+			return newGroup("."+source(inner.TreeNode.Name)+":", "group", pattern(inner.TreeNode.Pattern))
+		}
+		return newGroup("contains", "group", pattern(p.Contains.Pattern))
+	case p.Optional != nil:
+		return newBypass(pattern(p.Optional.Pattern))
+	case p.Interleave != nil:
+		return newParallel("in any order", operands(p, interleave)...)
+	}
+	return newBox(source(p), "terminal", "")
+}
+
+// binary returns the left and right patterns of the pattern, if it is the binary operator.
+type binary func(p *ast.Pattern) (left, right *ast.Pattern, ok bool)
+
+func concat(p *ast.Pattern) (*ast.Pattern, *ast.Pattern, bool) {
+	if p.Concat == nil {
+		return nil, nil, false
+	}
+	return p.Concat.LeftPattern, p.Concat.RightPattern, true
+}
+
+func or(p *ast.Pattern) (*ast.Pattern, *ast.Pattern, bool) {
+	if p.Or == nil {
+		return nil, nil, false
+	}
+	return p.Or.LeftPattern, p.Or.RightPattern, true
+}
+
+func and(p *ast.Pattern) (*ast.Pattern, *ast.Pattern, bool) {
+	if p.And == nil {
+		return nil, nil, false
+	}
+	return p.And.LeftPattern, p.And.RightPattern, true
+}
+
+func interleave(p *ast.Pattern) (*ast.Pattern, *ast.Pattern, bool) {
+	if p.Interleave == nil {
+		return nil, nil, false
+	}
+	return p.Interleave.LeftPattern, p.Interleave.RightPattern, true
+}
+
+// operands returns the elements of the operands of a chain of the same binary operator,
+// such as (a | (b | c)).
+func operands(p *ast.Pattern, op binary) []element {
+	left, right, ok := op(p)
+	if !ok {
+		return []element{pattern(p)}
+	}
+	var es []element
+	for _, side := range []*ast.Pattern{left, right} {
+		if side != nil {
+			es = append(es, operands(side, op)...)
+		}
+	}
+	return es
+}
+
+// source returns the relapse source of the node without the surrounding whitespace.
+func source(node interface{ String() string }) string {
+	return strings.TrimSpace(node.String())
+}
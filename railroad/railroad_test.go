@@ -0,0 +1,63 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package railroad
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/katydid/katydid/relapse"
+)
+
+var grammar = `#main = (.A == "x" | .B: [*, (@other)?])
+#other = (.C: * & @main)*
+#third = { .X: *; !(.Y: *) }`
+
+func TestWriteSVG(t *testing.T) {
+	g, err := relapse.Parse(grammar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := New(g)
+	var names []string
+	for _, d := range ds {
+		names = append(names, d.Name)
+	}
+	if strings.Join(names, ",") != "main,other,third" {
+		t.Fatalf("expected a diagram for every pattern declaration, but got %v", names)
+	}
+	buf := &bytes.Buffer{}
+	if err := WriteSVG(g, buf); err != nil {
+		t.Fatal(err)
+	}
+	d := xml.NewDecoder(bytes.NewReader(buf.Bytes()))
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{`id="railroad-other"`, `xlink:href="#railroad-other"`, `class="parallel"`, "in any order"} {
+		if !bytes.Contains(buf.Bytes(), []byte(want)) {
+			t.Fatalf("expected %s in the svg", want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package relapseviz
+
+import (
+	"github.com/awalterschulze/gographviz"
+)
+
+// reference is an ast.Reference found inside the PatternDecl named decl.
+type reference struct {
+	from string
+	decl string
+	name string
+}
+
+var (
+	referenceEdgeAttrs = map[string]string{
+		string(gographviz.Style):      "dashed",
+		string(gographviz.Color):      "blue",
+		string(gographviz.Constraint): "false",
+	}
+	recursiveEdgeAttrs = map[string]string{
+		string(gographviz.Style):      "dashed",
+		string(gographviz.Color):      "red",
+		string(gographviz.PenWidth):   "2",
+		string(gographviz.Constraint): "false",
+	}
+)
+
+// addReferences adds an edge from every Reference node to the node of the PatternDecl it refers to.
+// References to undeclared patterns are left without an edge.
+func (t *translator) addReferences() {
+	deps := make(map[string][]string)
+	for _, r := range t.refs {
+		deps[r.decl] = append(deps[r.decl], r.name)
+	}
+	for _, r := range t.refs {
+		to, ok := t.decls[r.name]
+		if !ok || to == "" {
+			continue
+		}
+		attrs := referenceEdgeAttrs
+		if reaches(deps, r.name, r.decl) {
+			attrs = recursiveEdgeAttrs
+		}
+		t.addEdge(r.from, "", to, "", attrs)
+	}
+}
+
+// reaches returns whether the PatternDecl named from references the PatternDecl named to,
+// either directly or transitively.
+func reaches(deps map[string][]string, from, to string) bool {
+	visited := make(map[string]bool)
+	var visit func(name string) bool
+	visit = func(name string) bool {
+		if name == to {
+			return true
+		}
+		if visited[name] {
+			return false
+		}
+		visited[name] = true
+		for _, next := range deps[name] {
+			if visit(next) {
+				return true
+			}
+		}
+		return false
+	}
+	return visit(from)
+}
@@ -0,0 +1,144 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package relapseviz
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+
+	"github.com/awalterschulze/gographviz"
+	"github.com/jmarais/relapseviz/svg"
+)
+
+// Renderer renders graphs.
+// The zero value lays out graphs with the Graphviz dot binary, as WriteSVG does.
+// The formats other than svg, such as png and pdf, are always written by Graphviz.
+type Renderer struct {
+	// BuiltinLayout lays out svg graphs with the built-in layered layout instead of Graphviz,
+	// which does not require Graphviz to be installed.
+	BuiltinLayout bool
+	// Graphviz configures the Graphviz binary, such as its path and layout engine.
+	Graphviz svg.Graphviz
+	// DPI is the resolution of the graphs written by Graphviz in pixels per inch, such as 300 for print,
+	// which is passed as the dpi attribute of the graph and scales the png output. Graphviz uses 96 if it is zero.
+	DPI float64
+	// Size is the maximum size of the graphs written by Graphviz in inches, such as "7.5,10",
+	// which is passed as the size attribute of the graph, where the graphs which are larger are scaled down
+	// and, if it ends in !, the graphs which are smaller are scaled up.
+	Size string
+}
+
+// WriteSVG writes the graph as pannable svg, laid out with the Graphviz dot binary.
+// Renderer lays it out with the built-in layout instead, which does not need Graphviz.
+func WriteSVG(graph *gographviz.Graph, w io.Writer) error {
+	return Renderer{}.WriteSVG(graph, w)
+}
+
+// WriteSVGContext writes the graph as pannable svg, laid out with the Graphviz dot binary,
+// which is killed when the context is done.
+func WriteSVGContext(ctx context.Context, graph *gographviz.Graph, w io.Writer) error {
+	return Renderer{}.WriteSVGContext(ctx, graph, w)
+}
+
+// WriteSVG writes the graph as pannable svg.
+func (r Renderer) WriteSVG(graph *gographviz.Graph, w io.Writer) error {
+	return r.WriteSVGContext(context.Background(), graph, w)
+}
+
+// WriteSVGContext writes the graph as pannable svg, where nothing is written if the context is done before the svg is.
+// The Graphviz binary is killed when the context is done, and the *svg.GraphvizError returned for it
+// wraps the error of the context, while the built-in layout only checks the context between its phases and sweeps,
+// and returns the error of the context as it is.
+// Graphviz errors are returned as a *svg.GraphvizNotFoundError if the binary is not found
+// and as a *svg.GraphvizError, which holds what it wrote to stderr, if it failed.
+func (r Renderer) WriteSVGContext(ctx context.Context, graph *gographviz.Graph, w io.Writer) error {
+	pp := r.graphviz().MassageSVGContext(ctx)
+	if r.BuiltinLayout {
+		pp = svg.LayoutSVGContext(ctx)
+	}
+	return pp(bytes.NewReader([]byte(graph.String())), w)
+}
+
+// WritePNG writes the graph as png, laid out with the Graphviz dot binary.
+func WritePNG(graph *gographviz.Graph, w io.Writer) error {
+	return Renderer{}.WritePNG(graph, w)
+}
+
+// WritePDF writes the graph as pdf, laid out with the Graphviz dot binary.
+func WritePDF(graph *gographviz.Graph, w io.Writer) error {
+	return Renderer{}.WritePDF(graph, w)
+}
+
+// WriteEPS writes the graph as encapsulated postscript, laid out with the Graphviz dot binary.
+func WriteEPS(graph *gographviz.Graph, w io.Writer) error {
+	return Renderer{}.WriteEPS(graph, w)
+}
+
+// WriteLayoutJSON writes the layout of the graph by the Graphviz dot binary as json,
+// which holds the positions of the nodes and the edges, to draw it with other tools.
+func WriteLayoutJSON(graph *gographviz.Graph, w io.Writer) error {
+	return Renderer{}.WriteLayoutJSON(graph, w)
+}
+
+// WritePNG writes the graph as png, laid out with Graphviz at the DPI of the renderer.
+func (r Renderer) WritePNG(graph *gographviz.Graph, w io.Writer) error {
+	return r.WriteFormat(context.Background(), "png", graph, w)
+}
+
+// WritePDF writes the graph as pdf, laid out with Graphviz.
+func (r Renderer) WritePDF(graph *gographviz.Graph, w io.Writer) error {
+	return r.WriteFormat(context.Background(), "pdf", graph, w)
+}
+
+// WriteEPS writes the graph as encapsulated postscript, laid out with Graphviz.
+func (r Renderer) WriteEPS(graph *gographviz.Graph, w io.Writer) error {
+	return r.WriteFormat(context.Background(), "eps", graph, w)
+}
+
+// WriteLayoutJSON writes the layout of the graph by Graphviz as json, which is the json output format of Graphviz.
+func (r Renderer) WriteLayoutJSON(graph *gographviz.Graph, w io.Writer) error {
+	return r.WriteFormat(context.Background(), "json", graph, w)
+}
+
+// WriteFormat writes the graph in the Graphviz output format, such as png, pdf, eps or json,
+// where the Graphviz binary is killed when the context is done.
+// The graph is not massaged, such as the pannable svg of WriteSVG, since it is written by Graphviz as it is.
+// The output is buffered, so that nothing is written if Graphviz fails, and the errors are returned as by WriteSVGContext.
+func (r Renderer) WriteFormat(ctx context.Context, format string, graph *gographviz.Graph, w io.Writer) error {
+	out := new(bytes.Buffer)
+	if err := r.graphviz().Invoke(ctx, format)(bytes.NewReader([]byte(graph.String())), out); err != nil {
+		return err
+	}
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// graphviz returns the configuration of the Graphviz binary, with the DPI and Size as graph attributes.
+func (r Renderer) graphviz() svg.Graphviz {
+	g := r.Graphviz
+	attrs := make(map[string]string)
+	if r.DPI > 0 {
+		attrs[string(gographviz.DPI)] = strconv.FormatFloat(r.DPI, 'f', -1, 64)
+	}
+	if r.Size != "" {
+		attrs[string(gographviz.Size)] = r.Size
+	}
+	if len(attrs) > 0 {
+		g.GraphAttrs = merge(g.GraphAttrs, attrs)
+	}
+	return g
+}
@@ -0,0 +1,122 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package relapseviz
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/awalterschulze/gographviz"
+	"github.com/katydid/katydid/relapse/ast"
+)
+
+// Position is a position in the relapse source, where the line and the column, which counts runes, start at 1.
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// sourceText tracks where the nodes are found in the relapse source of the grammar,
+// which is reconstructed by the String method of the ast, including its whitespace and comments.
+// Since the source of a node is the concatenation of the source of its keywords, spaces and children,
+// the source of every child is found after the source of its previous siblings.
+type sourceText struct {
+	text string
+	// lines holds the offsets at which the lines of the text start.
+	lines []int
+	// node is the source of the node being translated, which is found at offset at, or -1 if it was not found,
+	// and next is the offset after which the source of its next child is found.
+	node string
+	at   int
+	next int
+}
+
+func newSourceText(g *ast.Grammar) *sourceText {
+	text := g.String()
+	s := &sourceText{text: text, lines: []int{0}, node: text}
+	for i, c := range text {
+		if c == '\n' {
+			s.lines = append(s.lines, i+1)
+		}
+	}
+	return s
+}
+
+// seek finds the source of the child node after its previous siblings
+// and returns a function which restores the source of the parent, to continue with its next child.
+func (s *sourceText) seek(child interface{}) func() {
+	if s == nil {
+		return func() {}
+	}
+	node, at, next := s.node, s.at, s.next
+	s.node, s.at = "", -1
+	if str, ok := child.(fmt.Stringer); ok {
+		s.node = str.String()
+	}
+	if i := strings.Index(s.text[next:], s.node); s.node != "" && i >= 0 {
+		s.at = next + i
+		s.next = s.at
+	}
+	found, end := s.at, s.at+len(s.node)
+	return func() {
+		s.node, s.at, s.next = node, at, next
+		if found >= 0 {
+			s.next = end
+		}
+	}
+}
+
+// position returns the position of the offset in the text.
+func (s *sourceText) position(offset int) Position {
+	line := sort.Search(len(s.lines), func(i int) bool { return s.lines[i] > offset })
+	return Position{Line: line, Column: utf8.RuneCountInString(s.text[s.lines[line-1]:offset]) + 1}
+}
+
+// attrs returns the graphviz attributes of the node being translated, which hold its source without the surrounding whitespace:
+// the tooltip holds the source prefixed by the position where it starts, the comment its start and end positions
+// and, if the url is not empty, the URL links to its lines in the relapse file.
+// It returns nil if the source of the node was not found or is only whitespace.
+func (s *sourceText) attrs(url string) map[string]string {
+	if s == nil {
+		return nil
+	}
+	text := strings.TrimSpace(s.node)
+	if s.at < 0 || text == "" {
+		return nil
+	}
+	offset := s.at + len(s.node) - len(strings.TrimLeftFunc(s.node, unicode.IsSpace))
+	start, end := s.position(offset), s.position(offset+len(text))
+	// the end is the position of the last rune
+	end.Column--
+	attrs := map[string]string{
+		string(gographviz.Tooltip): quote(escape(start.String() + "\n" + text)),
+		string(gographviz.Comment): quote(escape(start.String() + "-" + end.String())),
+	}
+	if url != "" {
+		lines := fmt.Sprintf("#L%d", start.Line)
+		if end.Line != start.Line {
+			lines += fmt.Sprintf("-L%d", end.Line)
+		}
+		attrs[string(gographviz.URL)] = quote(escape(url + lines))
+	}
+	return attrs
+}
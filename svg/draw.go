@@ -0,0 +1,266 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package svg
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// draw writes the laid out graph as svg, in the same structure as the svg written by dot,
+// so that it can be massaged in the same way.
+func (g *graph) draw(output io.Writer) error {
+	w := bufio.NewWriter(output)
+	width, height := g.width+2*margin, g.height+2*margin
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\" standalone=\"no\"?>\n")
+	fmt.Fprintf(w, "<!-- Generated by relapseviz -->\n")
+	fmt.Fprintf(w, "<svg width=\"%.0fpt\" height=\"%.0fpt\"\n viewBox=\"0.00 0.00 %.2f %.2f\" xmlns=\"http://www.w3.org/2000/svg\" xmlns:xlink=\"http://www.w3.org/1999/xlink\">\n", width, height, width, height)
+	fmt.Fprintf(w, "<g id=\"graph0\" class=\"graph\" transform=\"translate(%.2f %.2f)\">\n", margin, margin)
+	fmt.Fprintf(w, "<title>%s</title>\n", escapeText(g.name))
+	bg := g.attrs["bgcolor"]
+	if bg == "" {
+		bg = "white"
+	}
+	fmt.Fprintf(w, "<polygon fill=\"%s\" stroke=\"transparent\" points=\"%s\"/>\n", escapeText(bg),
+		polygon(-margin, -margin, width, height))
+	for i, c := range g.clusters {
+		if len(c.nodes) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "<g id=\"clust%d\" class=\"cluster\">\n<title>%s</title>\n", i+1, escapeText(c.name))
+		fill := "none"
+		if strings.Contains(c.attrs["style"], "filled") {
+			fill = or(c.attrs["fillcolor"], c.attrs["color"], "lightgrey")
+		}
+		fmt.Fprintf(w, "<polygon fill=\"%s\" stroke=\"%s\"%s points=\"%s\"/>\n", escapeText(fill), escapeText(or(c.attrs["color"], "black")),
+			strokeStyle(c.attrs), polygon(c.x, c.y, c.w, c.h))
+		writeText(w, c.label, c.attrs, c.x+c.w/2, c.y+padding/2+fontSize, c.w)
+		fmt.Fprintf(w, "</g>\n")
+	}
+	for i, e := range g.edges {
+		if strings.Contains(e.attrs["style"], "invis") {
+			continue
+		}
+		fmt.Fprintf(w, "<g id=\"edge%d\" class=\"edge\">\n", i+1)
+		arrow := "&#45;&#45;"
+		if g.directed {
+			arrow = "&#45;&gt;"
+		}
+		fmt.Fprintf(w, "<title>%s%s%s</title>\n", escapeText(e.src.name), arrow, escapeText(e.dst.name))
+		color := or(e.attrs["color"], "black")
+		path, tip, dir := e.path()
+		fmt.Fprintf(w, "<path fill=\"none\" stroke=\"%s\"%s d=\"%s\"/>\n", escapeText(color), strokeStyle(e.attrs), path)
+		if g.directed && e.attrs["arrowhead"] != "none" {
+			fmt.Fprintf(w, "<polygon fill=\"%s\" stroke=\"%s\" points=\"%s\"/>\n", escapeText(color), escapeText(color), arrowhead(tip, dir))
+		}
+		if len(e.label) > 0 {
+			p := e.labelPoint()
+			lw, _ := textSize(e.label)
+			writeText(w, e.label, e.attrs, p.x+lw/2, p.y, lw)
+		}
+		fmt.Fprintf(w, "</g>\n")
+	}
+	for i, n := range g.nodes {
+		if strings.Contains(n.attrs["style"], "invis") {
+			continue
+		}
+		fmt.Fprintf(w, "<g id=\"node%d\" class=\"node\">\n<title>%s</title>\n", i+1, escapeText(n.name))
+		end := "</g>\n"
+		if a := anchor(n); a != "" {
+			fmt.Fprintf(w, "<g id=\"a_node%d\">%s\n", i+1, a)
+			end = "</a>\n</g>\n</g>\n"
+		}
+		color := or(n.attrs["color"], "black")
+		fill := "none"
+		if strings.Contains(n.attrs["style"], "filled") {
+			fill = or(n.attrs["fillcolor"], n.attrs["color"], "lightgrey")
+		}
+		attrs := fmt.Sprintf("fill=\"%s\" stroke=\"%s\"%s", escapeText(fill), escapeText(color), strokeStyle(n.attrs))
+		if shape(n) == "point" {
+			fmt.Fprintf(w, "<ellipse fill=\"%s\" stroke=\"%s\" cx=\"%.2f\" cy=\"%.2f\" rx=\"%.2f\" ry=\"%.2f\"/>\n%s",
+				escapeText(color), escapeText(color), n.x, n.y, n.w/2, n.h/2, end)
+			continue
+		}
+		// peripheries draws extra outlines inside the node
+		peripheries := 1
+		if p, err := strconv.Atoi(n.attrs["peripheries"]); err == nil && p > 1 {
+			peripheries = p
+		}
+		for p := 0; p < peripheries; p++ {
+			inset := float64(p) * 4
+			nw, nh := n.w-2*inset, n.h-2*inset
+			switch shape(n) {
+			case "ellipse":
+				fmt.Fprintf(w, "<ellipse %s cx=\"%.2f\" cy=\"%.2f\" rx=\"%.2f\" ry=\"%.2f\"/>\n", attrs, n.x, n.y, nw/2, nh/2)
+			case "box":
+				rounded := ""
+				if strings.Contains(n.attrs["style"], "rounded") || n.attrs["shape"] == "Mrecord" {
+					rounded = " rx=\"6\" ry=\"6\""
+				}
+				fmt.Fprintf(w, "<rect %s%s x=\"%.2f\" y=\"%.2f\" width=\"%.2f\" height=\"%.2f\"/>\n", attrs, rounded, n.x-nw/2, n.y-nh/2, nw, nh)
+			case "diamond":
+				fmt.Fprintf(w, "<polygon %s points=\"%.2f,%.2f %.2f,%.2f %.2f,%.2f %.2f,%.2f\"/>\n", attrs,
+					n.x, n.y-nh/2, n.x+nw/2, n.y, n.x, n.y+nh/2, n.x-nw/2, n.y)
+			}
+			attrs = fmt.Sprintf("fill=\"none\" stroke=\"%s\"%s", escapeText(color), strokeStyle(n.attrs))
+		}
+		_, th := textSize(n.label)
+		tw := n.w - 2*padding
+		if shape(n) == "ellipse" {
+			tw = n.w / math.Sqrt2
+		}
+		writeText(w, n.label, n.attrs, n.x, n.y-th/2+fontSize-2, tw)
+		fmt.Fprint(w, end)
+	}
+	if len(g.label) > 0 {
+		tw, th := textSize(g.label)
+		writeText(w, g.label, g.attrs, g.width/2, g.height-th+fontSize-2, tw)
+	}
+	fmt.Fprintf(w, "</g>\n</svg>\n")
+	return w.Flush()
+}
+
+// anchor returns the opening tag of the link around the node, as written by dot, for its URL and tooltip,
+// or empty if it has neither.
+func anchor(n *node) string {
+	url, tooltip := n.attrs["URL"], n.attrs["tooltip"]
+	if url == "" && tooltip == "" {
+		return ""
+	}
+	b := &strings.Builder{}
+	b.WriteString("<a")
+	if url != "" {
+		fmt.Fprintf(b, " xlink:href=\"%s\"", escapeText(url))
+	}
+	if tooltip != "" {
+		ls := labelLines(tooltip, n.name)
+		ss := make([]string, len(ls))
+		for i, l := range ls {
+			ss[i] = l.text
+		}
+		fmt.Fprintf(b, " xlink:title=\"%s\"", escapeText(strings.Join(ss, "\n")))
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// writeText writes the lines of text below each other, starting at the baseline y,
+// horizontally centered around x inside a box of the given width.
+func writeText(w io.Writer, ls []line, attrs map[string]string, x, y, width float64) {
+	family := or(attrs["fontname"], "Times,serif")
+	size := or(attrs["fontsize"], fmt.Sprintf("%.2f", fontSize))
+	color := or(attrs["fontcolor"], "black")
+	for i, l := range ls {
+		lx := x
+		switch l.anchor {
+		case "start":
+			lx = x - width/2
+		case "end":
+			lx = x + width/2
+		}
+		fmt.Fprintf(w, "<text text-anchor=\"%s\" x=\"%.2f\" y=\"%.2f\" font-family=\"%s\" font-size=\"%s\" fill=\"%s\">%s</text>\n",
+			l.anchor, lx, y+float64(i)*lineHeight, escapeText(family), escapeText(size), escapeText(color), escapeText(l.text))
+	}
+}
+
+// path returns the svg path of the edge, together with the point and the direction at which it ends.
+func (e *edge) path() (string, point, point) {
+	if e.src == e.dst {
+		n := e.src
+		a := point{n.x + n.w/2, n.y - n.h/4}
+		b := point{n.x + n.w/2, n.y + n.h/4}
+		return fmt.Sprintf("M%.2f,%.2f C%.2f,%.2f %.2f,%.2f %.2f,%.2f", a.x, a.y, a.x+30, a.y-10, b.x+30, b.y+10, b.x+5, b.y),
+			b, point{-1, 0}
+	}
+	ps := e.points()
+	last := ps[len(ps)-1]
+	prev := ps[len(ps)-2]
+	dx, dy := last.x-prev.x, last.y-prev.y
+	d := math.Hypot(dx, dy)
+	if d == 0 {
+		d = 1
+	}
+	dir := point{dx / d, dy / d}
+	// leave room for the arrowhead
+	ps[len(ps)-1] = point{last.x - dir.x*arrowLength, last.y - dir.y*arrowLength}
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "M%.2f,%.2f", ps[0].x, ps[0].y)
+	for i := 1; i < len(ps); i++ {
+		p, q := ps[i-1], ps[i]
+		my := (p.y + q.y) / 2
+		if !e.constraint {
+			fmt.Fprintf(b, " C%.2f,%.2f %.2f,%.2f %.2f,%.2f", p.x, p.y, q.x, q.y, q.x, q.y)
+			continue
+		}
+		fmt.Fprintf(b, " C%.2f,%.2f %.2f,%.2f %.2f,%.2f", p.x, my, q.x, my, q.x, q.y)
+	}
+	return b.String(), last, dir
+}
+
+const (
+	arrowLength = 10.0
+	arrowWidth  = 3.5
+)
+
+// arrowhead returns the points of an arrowhead ending at tip, pointing in the direction dir.
+func arrowhead(tip, dir point) string {
+	base := point{tip.x - dir.x*arrowLength, tip.y - dir.y*arrowLength}
+	normal := point{-dir.y * arrowWidth, dir.x * arrowWidth}
+	return fmt.Sprintf("%.2f,%.2f %.2f,%.2f %.2f,%.2f %.2f,%.2f",
+		base.x+normal.x, base.y+normal.y, tip.x, tip.y, base.x-normal.x, base.y-normal.y, base.x+normal.x, base.y+normal.y)
+}
+
+func polygon(x, y, w, h float64) string {
+	return fmt.Sprintf("%.2f,%.2f %.2f,%.2f %.2f,%.2f %.2f,%.2f %.2f,%.2f", x, y, x+w, y, x+w, y+h, x, y+h, x, y)
+}
+
+// strokeStyle returns the svg attributes for the dot style and penwidth.
+func strokeStyle(attrs map[string]string) string {
+	s := ""
+	style := attrs["style"]
+	switch {
+	case strings.Contains(style, "dashed"):
+		s += ` stroke-dasharray="5,2"`
+	case strings.Contains(style, "dotted"):
+		s += ` stroke-dasharray="1,5"`
+	}
+	if pw, ok := attrs["penwidth"]; ok {
+		s += fmt.Sprintf(` stroke-width="%s"`, escapeText(pw))
+	} else if strings.Contains(style, "bold") {
+		s += ` stroke-width="2"`
+	}
+	return s
+}
+
+// or returns the first non empty string.
+func or(ss ...string) string {
+	for _, s := range ss {
+		if s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+func escapeText(s string) string {
+	b := &strings.Builder{}
+	xml.EscapeText(b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,68 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package svg
+
+import "fmt"
+
+// GraphvizNotFoundError is returned when the Graphviz binary could not be found,
+// usually because Graphviz is not installed.
+type GraphvizNotFoundError struct {
+	// Path is the path of the binary, which is looked up in the PATH if it has no directory.
+	Path string
+	Err  error
+}
+
+func (e *GraphvizNotFoundError) Error() string {
+	return fmt.Sprintf("graphviz binary %s not found, is Graphviz installed? %v", e.Path, e.Err)
+}
+
+func (e *GraphvizNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// GraphvizError is returned when the Graphviz binary failed to lay out the graph,
+// which includes being killed when its context is done.
+type GraphvizError struct {
+	Path string
+	Args []string
+	// Stderr is what the binary wrote to stderr, such as the syntax errors in the graph.
+	Stderr string
+	Err    error
+}
+
+func (e *GraphvizError) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("graphviz %s failed: %v", e.Path, e.Err)
+	}
+	return fmt.Sprintf("graphviz %s failed: %v: %s", e.Path, e.Err, e.Stderr)
+}
+
+func (e *GraphvizError) Unwrap() error {
+	return e.Err
+}
+
+// MalformedSVGError is returned when the svg written by Graphviz, or the svg with the panning enhancements,
+// is not well-formed xml.
+type MalformedSVGError struct {
+	Err error
+}
+
+func (e *MalformedSVGError) Error() string {
+	return fmt.Sprintf("malformed svg: %v", e.Err)
+}
+
+func (e *MalformedSVGError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,883 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package svg
+
+import (
+	"context"
+	"html"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+// The layout is a layered (Sugiyama-style) layout:
+//
+//  - cycles are broken by reversing the back edges found by a depth first search,
+//  - nodes are assigned to ranks by the longest path from the sources,
+//  - edges spanning more than one rank are split by dummy nodes,
+//  - the order within the ranks is improved by barycenter sweeps, keeping the order with the fewest crossings and
+//  - nodes are placed over the barycenter of their neighbours, without overlapping.
+//
+// Edges with constraint=false, such as references, do not take part in the layout.
+
+const (
+	fontSize   = 14.0
+	charWidth  = 7.0
+	lineHeight = 16.0
+	padding    = 8.0
+	nodeSep    = 18.0
+	rankSep    = 40.0
+	margin     = 4.0
+	sweeps     = 8
+)
+
+type point struct {
+	x, y float64
+}
+
+type line struct {
+	text string
+	// anchor is the svg text-anchor: start, middle or end.
+	anchor string
+}
+
+type graph struct {
+	name     string
+	directed bool
+	attrs    map[string]string
+	nodes    []*node
+	edges    []*edge
+	ranks    [][]*node
+	clusters []*cluster
+	// label is drawn below the graph, where dot draws the label of the root graph by default.
+	label  []line
+	width  float64
+	height float64
+}
+
+type node struct {
+	name  string
+	attrs map[string]string
+	label []line
+	w, h  float64
+	rank  int
+	order int
+	x, y  float64
+	dummy bool
+	ups   []*node
+	downs []*node
+	// cluster is one more than the index of the innermost cluster holding the node, or zero.
+	cluster int
+}
+
+type edge struct {
+	src, dst   *node
+	attrs      map[string]string
+	label      []line
+	constraint bool
+	// reversed is set if the edge was reversed to break a cycle.
+	reversed bool
+	// chain holds the dummy nodes from the upper to the lower end of the edge.
+	chain []*node
+}
+
+type cluster struct {
+	name  string
+	attrs map[string]string
+	label []line
+	nodes []*node
+	x, y  float64
+	w, h  float64
+}
+
+// upper returns the end of the edge which is ranked first.
+func (e *edge) upper() *node {
+	if e.reversed {
+		return e.dst
+	}
+	return e.src
+}
+
+// lower returns the end of the edge which is ranked last.
+func (e *edge) lower() *node {
+	if e.reversed {
+		return e.src
+	}
+	return e.dst
+}
+
+// parse reads a dot graph.
+func parse(input io.Reader) (*graph, error) {
+	buf, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	dg, err := gographviz.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	g := &graph{
+		name:     unquote(dg.Name),
+		directed: dg.Directed,
+		attrs:    attrMap(dg.Attrs),
+	}
+	if label, ok := g.attrs["label"]; ok {
+		g.label = labelLines(label, "")
+	}
+	lookup := make(map[string]*node)
+	for _, n := range dg.Nodes.Nodes {
+		nn := &node{name: unquote(n.Name), attrs: attrMap(n.Attrs)}
+		label, ok := nn.attrs["label"]
+		if !ok {
+			label = `\N`
+		}
+		nn.label = labelLines(label, nn.name)
+		lookup[n.Name] = nn
+		g.nodes = append(g.nodes, nn)
+	}
+	for _, e := range dg.Edges.Edges {
+		src, dst := lookup[e.Src], lookup[e.Dst]
+		if src == nil || dst == nil {
+			continue
+		}
+		ee := &edge{src: src, dst: dst, attrs: attrMap(e.Attrs)}
+		ee.constraint = ee.attrs["constraint"] != "false" && src != dst
+		if label, ok := ee.attrs["label"]; ok {
+			ee.label = labelLines(label, "")
+		}
+		g.edges = append(g.edges, ee)
+	}
+	names := make([]string, 0, len(dg.SubGraphs.SubGraphs))
+	for name := range dg.SubGraphs.SubGraphs {
+		if strings.HasPrefix(unquote(name), "cluster") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c := &cluster{name: unquote(name), attrs: attrMap(dg.SubGraphs.SubGraphs[name].Attrs)}
+		if label, ok := c.attrs["label"]; ok {
+			c.label = labelLines(label, "")
+		}
+		for _, child := range descendants(dg, name) {
+			if n, ok := lookup[child]; ok {
+				c.nodes = append(c.nodes, n)
+				n.cluster = len(g.clusters) + 1
+			}
+		}
+		g.clusters = append(g.clusters, c)
+	}
+	return g, nil
+}
+
+// descendants returns the nodes inside the subgraph, including those in nested subgraphs.
+func descendants(dg *gographviz.Graph, name string) []string {
+	var ns []string
+	for _, child := range dg.Relations.SortedChildren(name) {
+		if dg.IsSubGraph(child) {
+			ns = append(ns, descendants(dg, child)...)
+		} else {
+			ns = append(ns, child)
+		}
+	}
+	return ns
+}
+
+func attrMap(attrs gographviz.Attrs) map[string]string {
+	m := make(map[string]string, len(attrs))
+	for k, v := range attrs {
+		m[string(k)] = unquote(v)
+	}
+	return m
+}
+
+// unquote removes the quotes around a dot string and unescapes the quotes inside it.
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	s = s[1 : len(s)-1]
+	b := &strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		// the other escapes, such as \\ and \n, are left for labelLines
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			if s[i] != '"' {
+				b.WriteByte('\\')
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// labelLines splits a dot label into lines, following the \n, \l and \r escapes,
+// where \N is replaced by the node name.
+func labelLines(label, nodeName string) []line {
+	if isHTML(label) {
+		return htmlLines(label)
+	}
+	var ls []line
+	b := &strings.Builder{}
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		if c != '\\' || i+1 == len(label) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch label[i] {
+		case 'n':
+			ls = append(ls, line{b.String(), "middle"})
+			b.Reset()
+		case 'l':
+			ls = append(ls, line{b.String(), "start"})
+			b.Reset()
+		case 'r':
+			ls = append(ls, line{b.String(), "end"})
+			b.Reset()
+		case 'N':
+			b.WriteString(nodeName)
+		default:
+			b.WriteByte(label[i])
+		}
+	}
+	if b.Len() > 0 || len(ls) == 0 {
+		ls = append(ls, line{b.String(), "middle"})
+	}
+	return ls
+}
+
+// isHTML returns whether the label is an html-like label, such as <<b>name</b>>.
+func isHTML(label string) bool {
+	return strings.HasPrefix(label, "<") && strings.HasSuffix(label, ">")
+}
+
+// htmlLines returns the text of an html-like label, with a line for every table row and line break,
+// where the cells of a row are separated by spaces.
+func htmlLines(label string) []line {
+	var ls []line
+	b := &strings.Builder{}
+	flush := func() {
+		if text := strings.TrimSpace(b.String()); text != "" {
+			ls = append(ls, line{html.UnescapeString(text), "middle"})
+		}
+		b.Reset()
+	}
+	s := label[1 : len(label)-1]
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			b.WriteString(s)
+			break
+		}
+		b.WriteString(s[:i])
+		s = s[i:]
+		j := strings.IndexByte(s, '>')
+		if j < 0 {
+			break
+		}
+		tag := strings.ToLower(strings.Trim(s[1:j], "/ "))
+		if k := strings.IndexByte(tag, ' '); k >= 0 {
+			tag = tag[:k]
+		}
+		switch {
+		case tag == "br" || tag == "tr" && s[1] == '/':
+			flush()
+		case tag == "td" && s[1] != '/' && strings.TrimSpace(b.String()) != "":
+			b.WriteString("  ")
+		}
+		s = s[j+1:]
+	}
+	flush()
+	if len(ls) == 0 {
+		ls = append(ls, line{"", "middle"})
+	}
+	return ls
+}
+
+// textSize estimates the size of the lines of text.
+func textSize(ls []line) (float64, float64) {
+	w := 0
+	for _, l := range ls {
+		if n := utf8.RuneCountInString(l.text); n > w {
+			w = n
+		}
+	}
+	return float64(w) * charWidth, float64(len(ls)) * lineHeight
+}
+
+// layout assigns a position to every node, edge and cluster.
+// It returns the error of the context if it is done, which is checked between the phases and between the sweeps.
+func (g *graph) layout(ctx context.Context) error {
+	lr := g.attrs["rankdir"] == "LR" || g.attrs["rankdir"] == "RL"
+	for _, n := range g.nodes {
+		n.w, n.h = nodeSize(n)
+		if lr {
+			n.w, n.h = n.h, n.w
+		}
+	}
+	for _, phase := range []func(){g.breakCycles, g.rank, g.addDummies} {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		phase()
+	}
+	if err := g.order(ctx); err != nil {
+		return err
+	}
+	if err := g.position(ctx); err != nil {
+		return err
+	}
+	if lr {
+		for _, n := range g.allNodes() {
+			n.x, n.y = n.y, n.x
+			n.w, n.h = n.h, n.w
+		}
+	}
+	g.bounds()
+	switch g.attrs["rankdir"] {
+	case "BT":
+		for _, n := range g.allNodes() {
+			n.y = g.height - n.y
+		}
+	case "RL":
+		for _, n := range g.allNodes() {
+			n.x = g.width - n.x
+		}
+	}
+	g.placeClusters()
+	if len(g.label) > 0 {
+		w, h := textSize(g.label)
+		g.width = math.Max(g.width, w)
+		g.height += h + padding
+	}
+	return nil
+}
+
+func nodeSize(n *node) (float64, float64) {
+	tw, th := textSize(n.label)
+	w, h := tw+2*padding, th+padding
+	switch shape(n) {
+	case "ellipse":
+		w, h = w*math.Sqrt2, h*math.Sqrt2
+		w, h = math.Max(w, 54), math.Max(h, 36)
+	case "none":
+	case "point":
+		return 8, 8
+	default:
+		w, h = math.Max(w, 54), math.Max(h, 36)
+	}
+	if p, err := strconv.Atoi(n.attrs["peripheries"]); err == nil && p > 1 {
+		w, h = w+float64(p-1)*8, h+float64(p-1)*8
+	}
+	return w, h
+}
+
+// shape returns the shape used to draw the node: box, ellipse, diamond, point or none.
+// Nodes with an html table label are drawn as a box, in place of the borders of the table.
+func shape(n *node) string {
+	if isHTML(n.attrs["label"]) {
+		return "box"
+	}
+	switch n.attrs["shape"] {
+	case "box", "rect", "rectangle", "square", "record", "Mrecord", "note", "tab", "folder", "box3d", "component":
+		return "box"
+	case "plaintext", "plain", "none":
+		return "none"
+	case "diamond":
+		return "diamond"
+	case "point":
+		return "point"
+	}
+	return "ellipse"
+}
+
+// breakCycles reverses the back edges, found by a depth first search, so that the constraint edges form a dag.
+func (g *graph) breakCycles() {
+	outs := make(map[*node][]*edge)
+	for _, e := range g.edges {
+		if e.constraint {
+			outs[e.src] = append(outs[e.src], e)
+		}
+	}
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[*node]int)
+	var visit func(n *node)
+	visit = func(n *node) {
+		state[n] = visiting
+		for _, e := range outs[n] {
+			switch state[e.dst] {
+			case visiting:
+				e.reversed = true
+			case unvisited:
+				visit(e.dst)
+			}
+		}
+		state[n] = visited
+	}
+	for _, n := range g.nodes {
+		if state[n] == unvisited {
+			visit(n)
+		}
+	}
+}
+
+// rank assigns every node to the rank one below its lowest ranked parent.
+func (g *graph) rank() {
+	ins := make(map[*node]int)
+	outs := make(map[*node][]*edge)
+	for _, e := range g.edges {
+		if e.constraint {
+			ins[e.lower()]++
+			outs[e.upper()] = append(outs[e.upper()], e)
+		}
+	}
+	var queue []*node
+	for _, n := range g.nodes {
+		if ins[n] == 0 {
+			queue = append(queue, n)
+		}
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, e := range outs[n] {
+			l := e.lower()
+			if n.rank+1 > l.rank {
+				l.rank = n.rank + 1
+			}
+			ins[l]--
+			if ins[l] == 0 {
+				queue = append(queue, l)
+			}
+		}
+	}
+}
+
+// addDummies splits the constraint edges into links between adjacent ranks.
+func (g *graph) addDummies() {
+	for _, e := range g.edges {
+		if !e.constraint {
+			continue
+		}
+		prev := e.upper()
+		for r := prev.rank + 1; r < e.lower().rank; r++ {
+			d := &node{dummy: true, rank: r}
+			if e.src.cluster == e.dst.cluster {
+				d.cluster = e.src.cluster
+			}
+			e.chain = append(e.chain, d)
+			link(prev, d)
+			prev = d
+		}
+		link(prev, e.lower())
+	}
+}
+
+func link(upper, lower *node) {
+	upper.downs = append(upper.downs, lower)
+	lower.ups = append(lower.ups, upper)
+}
+
+// allNodes returns the nodes and the dummy nodes.
+func (g *graph) allNodes() []*node {
+	var ns []*node
+	for _, r := range g.ranks {
+		ns = append(ns, r...)
+	}
+	return ns
+}
+
+// order places the nodes in their ranks, starting with the order of a depth first search,
+// which keeps the children of a node in the order of their edges,
+// and then improving it with barycenter sweeps.
+func (g *graph) order(ctx context.Context) error {
+	seen := make(map[*node]bool)
+	var visit func(n *node)
+	visit = func(n *node) {
+		if seen[n] {
+			return
+		}
+		seen[n] = true
+		for len(g.ranks) <= n.rank {
+			g.ranks = append(g.ranks, nil)
+		}
+		n.order = len(g.ranks[n.rank])
+		g.ranks[n.rank] = append(g.ranks[n.rank], n)
+		for _, d := range n.downs {
+			visit(d)
+		}
+	}
+	for _, n := range g.nodes {
+		if len(n.ups) == 0 {
+			visit(n)
+		}
+	}
+	for _, n := range g.nodes {
+		visit(n)
+	}
+	for _, rank := range g.ranks {
+		sortByBarycenter(rank, func(*node) []*node { return nil })
+	}
+	bestCrossings, err := g.crossings(ctx)
+	if err != nil {
+		return err
+	}
+	best := g.saveOrder()
+	for i := 0; i < sweeps && bestCrossings > 0; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if i%2 == 0 {
+			for r := 1; r < len(g.ranks); r++ {
+				sortByBarycenter(g.ranks[r], func(n *node) []*node { return n.ups })
+			}
+		} else {
+			for r := len(g.ranks) - 2; r >= 0; r-- {
+				sortByBarycenter(g.ranks[r], func(n *node) []*node { return n.downs })
+			}
+		}
+		c, err := g.crossings(ctx)
+		if err != nil {
+			return err
+		}
+		if c < bestCrossings {
+			best, bestCrossings = g.saveOrder(), c
+		}
+	}
+	for r := range g.ranks {
+		g.ranks[r] = best[r]
+		for i, n := range g.ranks[r] {
+			n.order = i
+		}
+	}
+	return nil
+}
+
+func (g *graph) saveOrder() [][]*node {
+	saved := make([][]*node, len(g.ranks))
+	for r := range g.ranks {
+		saved[r] = append([]*node(nil), g.ranks[r]...)
+	}
+	return saved
+}
+
+// sortByBarycenter sorts the rank by the average order of the neighbours of every node,
+// where nodes without neighbours keep their order.
+// The nodes of a cluster are kept next to each other, so that clusters do not overlap.
+func sortByBarycenter(rank []*node, neighbours func(*node) []*node) {
+	bary := make(map[*node]float64, len(rank))
+	for _, n := range rank {
+		ns := neighbours(n)
+		if len(ns) == 0 {
+			bary[n] = float64(n.order)
+			continue
+		}
+		sum := 0.0
+		for _, m := range ns {
+			sum += float64(m.order)
+		}
+		bary[n] = sum / float64(len(ns))
+	}
+	sort.SliceStable(rank, func(i, j int) bool {
+		if rank[i].cluster != rank[j].cluster {
+			return rank[i].cluster < rank[j].cluster
+		}
+		return bary[rank[i]] < bary[rank[j]]
+	})
+	for i, n := range rank {
+		n.order = i
+	}
+}
+
+// crossings counts the crossings between the links of adjacent ranks,
+// which are the inversions of the lower ends of the links when they are sorted by their upper ends.
+func (g *graph) crossings(ctx context.Context) (int, error) {
+	c := 0
+	for _, rank := range g.ranks {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		var lowers []int
+		for _, n := range rank {
+			start := len(lowers)
+			for _, d := range n.downs {
+				lowers = append(lowers, d.order)
+			}
+			// the links of a node do not cross each other
+			sort.Ints(lowers[start:])
+		}
+		c += inversions(lowers, make([]int, len(lowers)))
+	}
+	return c, nil
+}
+
+// inversions merge sorts the orders and returns the number of pairs which were out of order.
+func inversions(orders, tmp []int) int {
+	if len(orders) < 2 {
+		return 0
+	}
+	mid := len(orders) / 2
+	c := inversions(orders[:mid], tmp[:mid]) + inversions(orders[mid:], tmp[mid:])
+	i, j, k := 0, mid, 0
+	for ; i < mid && j < len(orders); k++ {
+		if orders[j] < orders[i] {
+			// orders[j] is less than every order left in the first half
+			c += mid - i
+			tmp[k] = orders[j]
+			j++
+		} else {
+			tmp[k] = orders[i]
+			i++
+		}
+	}
+	k += copy(tmp[k:], orders[i:mid])
+	copy(tmp[k:], orders[j:])
+	copy(orders, tmp)
+	return c
+}
+
+// position assigns coordinates to the nodes, placing the ranks below each other and
+// moving the nodes towards the barycenter of their neighbours, alternating between
+// the children and the parents.
+func (g *graph) position(ctx context.Context) error {
+	y := 0.0
+	for _, rank := range g.ranks {
+		h := 0.0
+		for _, n := range rank {
+			h = math.Max(h, n.h)
+		}
+		for _, n := range rank {
+			n.y = y + h/2
+		}
+		y += h + rankSep
+		place(rank, make([]float64, len(rank)))
+	}
+	for i := 0; i < sweeps; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if i%2 == 0 {
+			for r := len(g.ranks) - 2; r >= 0; r-- {
+				align(g.ranks[r], func(n *node) []*node { return n.downs })
+			}
+		} else {
+			for r := 1; r < len(g.ranks); r++ {
+				align(g.ranks[r], func(n *node) []*node { return n.ups })
+			}
+		}
+	}
+	g.separateClusters()
+	minX := math.Inf(1)
+	for _, n := range g.allNodes() {
+		minX = math.Min(minX, n.x-n.w/2)
+	}
+	for _, n := range g.allNodes() {
+		n.x -= minX
+	}
+	return nil
+}
+
+// separateClusters moves every cluster to the right of the clusters before it,
+// leaving room for their borders, since order keeps the nodes of a cluster next to each other.
+func (g *graph) separateClusters() {
+	ns := g.allNodes()
+	for k := 2; k <= len(g.clusters); k++ {
+		left, right := math.Inf(1), math.Inf(-1)
+		for _, n := range ns {
+			switch {
+			case n.cluster == k:
+				left = math.Min(left, n.x-n.w/2)
+			case n.cluster > 0 && n.cluster < k:
+				right = math.Max(right, n.x+n.w/2)
+			}
+		}
+		overlap := right + 2*padding + nodeSep - left
+		if math.IsInf(overlap, 0) || overlap <= 0 {
+			continue
+		}
+		for _, n := range ns {
+			if n.cluster >= k {
+				n.x += overlap
+			}
+		}
+	}
+}
+
+// align moves the nodes of the rank towards the average position of their neighbours.
+func align(rank []*node, neighbours func(*node) []*node) {
+	want := make([]float64, len(rank))
+	for i, n := range rank {
+		want[i] = n.x
+		if ns := neighbours(n); len(ns) > 0 {
+			sum := 0.0
+			for _, m := range ns {
+				sum += m.x
+			}
+			want[i] = sum / float64(len(ns))
+		}
+	}
+	place(rank, want)
+}
+
+// place positions the nodes of the rank as close as possible to the wanted positions, without overlapping.
+func place(rank []*node, want []float64) {
+	n := len(rank)
+	if n == 0 {
+		return
+	}
+	gap := func(i int) float64 { return (rank[i-1].w+rank[i].w)/2 + nodeSep }
+	left := make([]float64, n)
+	right := make([]float64, n)
+	for i := 0; i < n; i++ {
+		left[i] = want[i]
+		if i > 0 {
+			left[i] = math.Max(left[i], left[i-1]+gap(i))
+		}
+	}
+	for i := n - 1; i >= 0; i-- {
+		right[i] = want[i]
+		if i < n-1 {
+			right[i] = math.Min(right[i], right[i+1]-gap(i+1))
+		}
+	}
+	for i := 0; i < n; i++ {
+		rank[i].x = (left[i] + right[i]) / 2
+		if i > 0 {
+			rank[i].x = math.Max(rank[i].x, rank[i-1].x+gap(i))
+		}
+	}
+}
+
+// bounds computes the size of the drawing.
+func (g *graph) bounds() {
+	g.width, g.height = 0, 0
+	for _, n := range g.nodes {
+		g.width = math.Max(g.width, n.x+n.w/2)
+		g.height = math.Max(g.height, n.y+n.h/2)
+	}
+	for _, e := range g.edges {
+		if len(e.label) == 0 {
+			continue
+		}
+		p := e.labelPoint()
+		w, h := textSize(e.label)
+		g.width = math.Max(g.width, p.x+w)
+		g.height = math.Max(g.height, p.y+h)
+	}
+}
+
+// placeClusters draws every cluster around its nodes, leaving room for its label.
+func (g *graph) placeClusters() {
+	for _, c := range g.clusters {
+		if len(c.nodes) == 0 {
+			continue
+		}
+		minX, minY := math.Inf(1), math.Inf(1)
+		maxX, maxY := math.Inf(-1), math.Inf(-1)
+		for _, n := range c.nodes {
+			minX, minY = math.Min(minX, n.x-n.w/2), math.Min(minY, n.y-n.h/2)
+			maxX, maxY = math.Max(maxX, n.x+n.w/2), math.Max(maxY, n.y+n.h/2)
+		}
+		_, th := textSize(c.label)
+		c.x, c.y = minX-padding, minY-padding-th
+		c.w, c.h = maxX-minX+2*padding, maxY-minY+2*padding+th
+	}
+	for _, c := range g.clusters {
+		if c.x < 0 || c.y < 0 {
+			g.shift(math.Max(0, -c.x), math.Max(0, -c.y))
+		}
+	}
+	for _, c := range g.clusters {
+		g.width = math.Max(g.width, c.x+c.w)
+		g.height = math.Max(g.height, c.y+c.h)
+	}
+}
+
+// shift moves the whole drawing.
+func (g *graph) shift(dx, dy float64) {
+	for _, n := range g.allNodes() {
+		n.x += dx
+		n.y += dy
+	}
+	for _, c := range g.clusters {
+		c.x += dx
+		c.y += dy
+	}
+	g.width += dx
+	g.height += dy
+}
+
+// points returns the points the edge passes through, from its source to its destination.
+func (e *edge) points() []point {
+	ps := []point{{e.src.x, e.src.y}}
+	chain := e.chain
+	if e.reversed {
+		chain = make([]*node, len(e.chain))
+		for i, d := range e.chain {
+			chain[len(chain)-1-i] = d
+		}
+	}
+	for _, d := range chain {
+		ps = append(ps, point{d.x, d.y})
+	}
+	ps = append(ps, point{e.dst.x, e.dst.y})
+	ps[0] = clip(e.src, ps[1])
+	ps[len(ps)-1] = clip(e.dst, ps[len(ps)-2])
+	return ps
+}
+
+// labelPoint returns the point where the label of the edge is written.
+func (e *edge) labelPoint() point {
+	ps := e.points()
+	a, b := ps[(len(ps)-1)/2], ps[len(ps)/2]
+	if len(ps) == 2 {
+		a, b = ps[0], ps[1]
+	}
+	return point{(a.x+b.x)/2 + padding/2, (a.y + b.y) / 2}
+}
+
+// clip returns the point where the line from the center of the node towards p leaves the node's shape.
+func clip(n *node, p point) point {
+	dx, dy := p.x-n.x, p.y-n.y
+	if dx == 0 && dy == 0 {
+		return p
+	}
+	hw, hh := n.w/2, n.h/2
+	var t float64
+	switch shape(n) {
+	case "ellipse", "point":
+		t = 1 / math.Sqrt((dx*dx)/(hw*hw)+(dy*dy)/(hh*hh))
+	case "diamond":
+		t = 1 / (math.Abs(dx)/hw + math.Abs(dy)/hh)
+	default:
+		t = math.Min(hw/math.Abs(dx), hh/math.Abs(dy))
+	}
+	if n.dummy || t > 1 {
+		return p
+	}
+	return point{n.x + dx*t, n.y + dy*t}
+}
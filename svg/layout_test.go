@@ -0,0 +1,145 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package svg
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var layoutGraph = `digraph G {
+	a -> b [ label="left" ];
+	a -> c [ label="right" ];
+	b -> d;
+	c -> d;
+	a -> d;
+	d -> a [ constraint=false, style=dashed ];
+	d -> b;
+	subgraph cluster_main {
+		label="main";
+		b [ shape=box, label="B\nLeft" ];
+		c;
+	}
+}`
+
+func TestLayout(t *testing.T) {
+	for _, rankdir := range []string{"TB", "LR", "BT", "RL"} {
+		g, err := parse(strings.NewReader(strings.Replace(layoutGraph, "{", "{ rankdir="+rankdir+";", 1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := g.layout(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		// the boxes are compared, instead of the order within the ranks, since the ranks run across for LR and RL
+		for i, a := range g.nodes {
+			for _, b := range g.nodes[i+1:] {
+				if math.Abs(a.x-b.x) < (a.w+b.w)/2 && math.Abs(a.y-b.y) < (a.h+b.h)/2 {
+					t.Fatalf("%s: nodes %s and %s overlap", rankdir, a.name, b.name)
+				}
+			}
+		}
+		for _, n := range g.nodes {
+			if n.x-n.w/2 < 0 || n.y-n.h/2 < 0 || n.x+n.w/2 > g.width || n.y+n.h/2 > g.height {
+				t.Fatalf("%s: node %s is outside the drawing", rankdir, n.name)
+			}
+		}
+	}
+}
+
+func TestCrossings(t *testing.T) {
+	g, err := parse(strings.NewReader(`digraph G { a -> x; a -> y; b -> x; b -> z; c -> y; }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.layout(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// a, b, c above z, y, x, where a -> x crosses b -> z and c -> y, a -> y crosses b -> z and b -> x crosses c -> y
+	for r, rank := range g.ranks {
+		sort.Slice(rank, func(i, j int) bool { return (rank[i].name < rank[j].name) == (r == 0) })
+		for i, n := range rank {
+			n.order = i
+		}
+	}
+	got, err := g.crossings(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 4 {
+		t.Fatalf("expected 4 crossings, but got %d", got)
+	}
+}
+
+func TestLayoutSVG(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := LayoutSVG()(strings.NewReader(layoutGraph), buf); err != nil {
+		t.Fatal(err)
+	}
+	d := xml.NewDecoder(buf)
+	for {
+		if _, err := d.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// countdown is a context which is canceled after its error was checked n times.
+type countdown struct {
+	context.Context
+	n int
+}
+
+func (c *countdown) Err() error {
+	if c.n == 0 {
+		return context.Canceled
+	}
+	c.n--
+	return nil
+}
+
+func TestLayoutContext(t *testing.T) {
+	checks := 0
+	for ; ; checks++ {
+		g, err := parse(strings.NewReader(layoutGraph))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := &countdown{Context: context.Background(), n: checks}
+		if err := g.layout(ctx); err == nil {
+			break
+		} else if err != context.Canceled {
+			t.Fatal(err)
+		}
+	}
+	// between the phases and the sweeps of position, besides those of order if there are crossings
+	if checks <= sweeps {
+		t.Fatalf("expected the context to be checked between the sweeps, but it was checked %d times", checks)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	buf := new(bytes.Buffer)
+	if err := LayoutSVGContext(ctx)(strings.NewReader(layoutGraph), buf); err != context.Canceled || buf.Len() > 0 {
+		t.Fatalf("expected the layout to stop without writing, but got %v and %d bytes", err, buf.Len())
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+const viewportStart = `<g id="viewport" transform="scale(0.5,0.5) translate(0,0)">`
+
+// massageSVG enhances the SVG output from DOT to provide better
+// panning inside a web browser. It uses the svgpan library, which is
+// embedded into the svgpan.JSSource variable.
+// It returns a *MalformedSVGError if the svg, or the result, is not well-formed xml.
+func massageSVG(svg []byte) ([]byte, error) {
+	// Work around for dot bug which misses quoting some ampersands,
+	// resulting on unparsable SVG.
+	svg = bytes.Replace(svg, []byte("&;"), []byte("&amp;;"), -1)
+
+	// Dot's SVG output is
+	//
+	//    <svg width="___" height="___"
+	//     viewBox="___" xmlns=...>
+	//    <g id="graph0" transform="...">
+	//    ...
+	//    </g>
+	//    </svg>
+	//
+	// Change it to
+	//
+	//    <svg width="100%" height="100%" xmlns=...>
+	//    <script type="text/ecmascript"><![CDATA[` ..$(svgpan.JSSource)... `]]></script>`
+	//    <g id="viewport" transform="scale(0.5,0.5) translate(0,0)">
+	//    <g id="graph0" transform="...">
+	//    ...
+	//    </g>
+	//    </g>
+	//    </svg>
+	//
+	// The svg is rewritten token by token, rather than matched as text, since the formatting of the svg element
+	// and the id of the graph, which is the id attribute of the dot graph if it has one, differ between Graphviz versions.
+	// Every child element of the svg element goes inside the viewport, whatever its id.
+	// The raw tokens keep the prefixes of the names, such as xlink:href, which are written back as they are.
+	d := xml.NewDecoder(bytes.NewReader(svg))
+	// html-like labels can hold html entities, such as &nbsp;
+	d.Entity = xml.HTMLEntity
+	out := &bytes.Buffer{}
+	w := &xmlWriter{w: out}
+	depth, root, wrapped := 0, false, false
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, &MalformedSVGError{Err: err}
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case depth == 0 && t.Name.Local != "svg":
+				return nil, &MalformedSVGError{Err: errors.New("expected an svg element, but found " + t.Name.Local)}
+			case depth == 0:
+				t = fillWindow(t)
+				root = true
+			case depth == 1 && !wrapped:
+				w.raw(panScript + viewportStart)
+				wrapped = true
+			}
+			depth++
+			w.token(t)
+		case xml.EndElement:
+			depth--
+			if depth == 0 {
+				if !wrapped {
+					w.raw(panScript + viewportStart)
+					wrapped = true
+				}
+				w.raw(`</g>`)
+			}
+			w.token(t)
+		default:
+			w.token(t)
+		}
+	}
+	if !root {
+		return nil, &MalformedSVGError{Err: errors.New("no svg element found")}
+	}
+	if err := wellFormed(out.Bytes()); err != nil {
+		return nil, &MalformedSVGError{Err: err}
+	}
+	return out.Bytes(), nil
+}
+
+// fillWindow sets the width and height of the svg element to 100% and removes its viewBox,
+// so that the svg fills the window and the svgpan library scales it instead of the browser.
+func fillWindow(svg xml.StartElement) xml.StartElement {
+	attrs := []xml.Attr{
+		{Name: xml.Name{Local: "width"}, Value: "100%"},
+		{Name: xml.Name{Local: "height"}, Value: "100%"},
+	}
+	for _, a := range svg.Attr {
+		if a.Name.Space == "" && (a.Name.Local == "width" || a.Name.Local == "height" || a.Name.Local == "viewBox") {
+			continue
+		}
+		attrs = append(attrs, a)
+	}
+	svg.Attr = attrs
+	return svg
+}
+
+// wellFormed returns an error if the svg is not well-formed xml.
+func wellFormed(svg []byte) error {
+	d := xml.NewDecoder(bytes.NewReader(svg))
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+var (
+	textEscaper = strings.NewReplacer(`&`, `&amp;`, `<`, `&lt;`, `>`, `&gt;`)
+	attrEscaper = strings.NewReplacer(`&`, `&amp;`, `<`, `&lt;`, `>`, `&gt;`, `"`, `&quot;`, "\n", `&#xA;`, "\r", `&#xD;`, "\t", `&#x9;`)
+)
+
+// xmlWriter writes the raw tokens read by a xml.Decoder back as xml, which xml.Encoder cannot do,
+// since it takes the prefixes of the names, such as xlink in xlink:href, to be namespaces.
+// Empty elements are written as <path .../>, as dot writes them.
+type xmlWriter struct {
+	w *bytes.Buffer
+	// open is whether the last start element is not closed yet by >, since it could be empty.
+	open bool
+}
+
+// raw writes xml which is not read from the decoder.
+func (w *xmlWriter) raw(s string) {
+	w.close()
+	w.w.WriteString(s)
+}
+
+func (w *xmlWriter) close() {
+	if w.open {
+		w.w.WriteString(">")
+		w.open = false
+	}
+}
+
+func (w *xmlWriter) token(tok xml.Token) {
+	switch t := tok.(type) {
+	case xml.StartElement:
+		w.close()
+		w.w.WriteString("<" + xmlName(t.Name))
+		for _, a := range t.Attr {
+			w.w.WriteString(" " + xmlName(a.Name) + `="` + attrEscaper.Replace(a.Value) + `"`)
+		}
+		w.open = true
+	case xml.EndElement:
+		if w.open {
+			w.w.WriteString("/>")
+			w.open = false
+			return
+		}
+		w.w.WriteString("</" + xmlName(t.Name) + ">")
+	case xml.CharData:
+		w.close()
+		w.w.WriteString(textEscaper.Replace(string(t)))
+	case xml.Comment:
+		w.close()
+		w.w.WriteString("<!--" + string(t) + "-->")
+	case xml.ProcInst:
+		w.close()
+		w.w.WriteString("<?" + t.Target)
+		if len(t.Inst) > 0 {
+			w.w.WriteString(" " + string(t.Inst))
+		}
+		w.w.WriteString("?>")
+	case xml.Directive:
+		w.close()
+		w.w.WriteString("<!" + string(t) + ">")
+	}
+}
+
+// xmlName returns the name with its prefix, as it is written in the xml.
+func xmlName(n xml.Name) string {
+	if n.Space == "" {
+		return n.Local
+	}
+	return n.Space + ":" + n.Local
+}
@@ -16,93 +16,164 @@ package svg
 
 import (
 	"bytes"
-	"fmt"
+	"context"
+	"errors"
 	"io"
 	"os"
 	"os/exec"
-	"regexp"
+	"sort"
 	"strings"
 )
 
-func invokeDot(format string) func(input io.Reader, output io.Writer) error {
+// Graphviz configures how the Graphviz binary is invoked to lay out the graphs.
+// The zero value invokes the binary named by $GRAPHVIZ_DOT, or else dot from the PATH, with its default layout engine.
+type Graphviz struct {
+	// Path is the path of the Graphviz binary, $GRAPHVIZ_DOT or else dot when empty.
+	Path string
+	// Engine is the layout engine, such as dot, neato, fdp, sfdp, twopi or circo, which is passed as -K.
+	// The layout attribute of a graph takes precedence over it.
+	Engine string
+	// GraphAttrs, NodeAttrs and EdgeAttrs are passed as -G, -N and -E,
+	// which set the default attributes of the graph, the nodes and the edges.
+	GraphAttrs map[string]string
+	NodeAttrs  map[string]string
+	EdgeAttrs  map[string]string
+	// Args are extra arguments passed to the binary.
+	Args []string
+	// Stderr receives the warnings which the binary writes to stderr, which are dropped if it is nil.
+	// The errors are returned as a *GraphvizError either way.
+	Stderr io.Writer
+}
+
+// path returns the path of the Graphviz binary.
+func (g Graphviz) path() string {
+	if g.Path != "" {
+		return g.Path
+	}
+	if path := os.Getenv("GRAPHVIZ_DOT"); path != "" {
+		return path
+	}
+	return "dot"
+}
+
+// args returns the arguments of the Graphviz binary to write the format,
+// where the attributes are sorted to invoke it the same way every time.
+func (g Graphviz) args(format string) []string {
+	args := []string{"-T" + format}
+	if g.Engine != "" {
+		args = append(args, "-K"+g.Engine)
+	}
+	for _, a := range []struct {
+		flag  string
+		attrs map[string]string
+	}{{"-G", g.GraphAttrs}, {"-N", g.NodeAttrs}, {"-E", g.EdgeAttrs}} {
+		names := make([]string, 0, len(a.attrs))
+		for name := range a.attrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			args = append(args, a.flag+name+"="+a.attrs[name])
+		}
+	}
+	return append(args, g.Args...)
+}
+
+// Invoke returns a function which writes the dot graph in the Graphviz output format, such as svg, png, pdf, eps or json,
+// with the Graphviz binary, which is killed when the context is done.
+// It returns a *GraphvizNotFoundError if the binary is not found and a *GraphvizError if it fails.
+func (g Graphviz) Invoke(ctx context.Context, format string) func(input io.Reader, output io.Writer) error {
 	return func(input io.Reader, output io.Writer) error {
-		cmd := exec.Command("dot", "-T"+format)
-		cmd.Stdin, cmd.Stdout, cmd.Stderr = input, output, os.Stderr
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to execute dot. Is Graphviz installed? Error: %v", err)
+		path, args := g.path(), g.args(format)
+		stderr := new(bytes.Buffer)
+		cmd := exec.CommandContext(ctx, path, args...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = input, output, stderr
+		if g.Stderr != nil {
+			cmd.Stderr = io.MultiWriter(stderr, g.Stderr)
+		}
+		err := cmd.Run()
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+			return &GraphvizNotFoundError{Path: path, Err: err}
+		}
+		if ctx.Err() != nil {
+			// the binary was killed, which is reported instead of the signal
+			err = ctx.Err()
 		}
-		return nil
+		return &GraphvizError{Path: path, Args: args, Stderr: strings.TrimSpace(stderr.String()), Err: err}
 	}
 }
 
 func MassageDotSVG() func(input io.Reader, output io.Writer) error {
-	generateSVG := invokeDot("svg")
+	return Graphviz{}.MassageSVG()
+}
+
+// MassageSVG returns a function which lays out the dot graph with the Graphviz binary
+// and writes it as svg with the panning enhancements of massageSVG.
+func (g Graphviz) MassageSVG() func(input io.Reader, output io.Writer) error {
+	return g.MassageSVGContext(context.Background())
+}
+
+// MassageSVGContext is like MassageSVG, but kills the Graphviz binary when the context is done.
+func (g Graphviz) MassageSVGContext(ctx context.Context) func(input io.Reader, output io.Writer) error {
+	generateSVG := g.Invoke(ctx, "svg")
 	return func(input io.Reader, output io.Writer) error {
 		baseSVG := new(bytes.Buffer)
 		if err := generateSVG(input, baseSVG); err != nil {
 			return err
 		}
-		_, err := output.Write([]byte(massageSVG(baseSVG.String())))
+		svg, err := massageSVG(baseSVG.Bytes())
+		if err != nil {
+			return err
+		}
+		_, err = output.Write(svg)
 		return err
 	}
 }
 
-var (
-	viewBox  = regexp.MustCompile(`<svg\s*width="[^"]+"\s*height="[^"]+"\s*viewBox="[^"]+"`)
-	graphID  = regexp.MustCompile(`<g id="graph\d"`)
-	svgClose = regexp.MustCompile(`</svg>`)
-)
-
-// massageSVG enhances the SVG output from DOT to provide better
-// panning inside a web browser. It uses the svgpan library, which is
-// embedded into the svgpan.JSSource variable.
-func massageSVG(svg string) string {
-	// Work around for dot bug which misses quoting some ampersands,
-	// resulting on unparsable SVG.
-	svg = strings.Replace(svg, "&;", "&amp;;", -1)
-
-	// Dot's SVG output is
-	//
-	//    <svg width="___" height="___"
-	//     viewBox="___" xmlns=...>
-	//    <g id="graph0" transform="...">
-	//    ...
-	//    </g>
-	//    </svg>
-	//
-	// Change it to
-	//
-	//    <svg width="100%" height="100%"
-	//     xmlns=...>
-
-	//    <script type="text/ecmascript"><![CDATA[` ..$(svgpan.JSSource)... `]]></script>`
-	//    <g id="viewport" transform="translate(0,0)">
-	//    <g id="graph0" transform="...">
-	//    ...
-	//    </g>
-	//    </g>
-	//    </svg>
+// LayoutSVG returns a function which lays out the dot graph with the built-in layered layout,
+// instead of invoking the Graphviz dot binary, and writes it as svg with the same
+// panning enhancements as MassageDotSVG.
+func LayoutSVG() func(input io.Reader, output io.Writer) error {
+	return LayoutSVGContext(context.Background())
+}
 
-	if loc := viewBox.FindStringIndex(svg); loc != nil {
-		svg = svg[:loc[0]] +
-			`<svg width="100%" height="100%"` +
-			svg[loc[1]:]
+// LayoutSVGContext is like LayoutSVG, but stops the layout when the context is done
+// and returns the error of the context without writing anything.
+func LayoutSVGContext(ctx context.Context) func(input io.Reader, output io.Writer) error {
+	return func(input io.Reader, output io.Writer) error {
+		g, err := parse(input)
+		if err != nil {
+			return err
+		}
+		if err := g.layout(ctx); err != nil {
+			return err
+		}
+		baseSVG := new(bytes.Buffer)
+		if err := g.draw(baseSVG); err != nil {
+			return err
+		}
+		svg, err := massageSVG(baseSVG.Bytes())
+		if err != nil {
+			return err
+		}
+		_, err = output.Write(svg)
+		return err
 	}
+}
 
-	if loc := graphID.FindStringIndex(svg); loc != nil {
-		svg = svg[:loc[0]] +
-			`<script type="text/ecmascript"><![CDATA[` + string(JSSource) + `]]></script>` +
-			`<g id="viewport" transform="scale(0.5,0.5) translate(0,0)">` +
-			svg[loc[0]:]
-	}
+var panScript = `<script type="text/ecmascript"><![CDATA[` + JSSource + `]]></script>`
 
-	if loc := svgClose.FindStringIndex(svg); loc != nil {
-		svg = svg[:loc[0]] +
-			`</g>` +
-			svg[loc[0]:]
+// Embeddable returns the svg written by MassageDotSVG or LayoutSVG without its xml declaration,
+// doctype and panning script, so that it can be embedded inline into an html page, which has to pan it itself.
+// The graph is still inside the g element with the id viewport.
+func Embeddable(svg string) string {
+	if i := strings.Index(svg, "<svg"); i >= 0 {
+		svg = svg[i:]
 	}
-
-	return svg
+	return strings.Replace(svg, panScript, "", 1)
 }
 
 const JSSource = `
@@ -0,0 +1,220 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package svg
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmarais/relapseviz/internal/graphviztest"
+)
+
+func TestGraphvizArgs(t *testing.T) {
+	g := Graphviz{
+		Engine:     "neato",
+		GraphAttrs: map[string]string{"splines": "true", "overlap": "false"},
+		NodeAttrs:  map[string]string{"shape": "box"},
+		EdgeAttrs:  map[string]string{"color": "grey"},
+		Args:       []string{"-v"},
+	}
+	want := []string{"-Tsvg", "-Kneato", "-Goverlap=false", "-Gsplines=true", "-Nshape=box", "-Ecolor=grey", "-v"}
+	if got := g.args("svg"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, but got %v", want, got)
+	}
+}
+
+func TestGraphvizPath(t *testing.T) {
+	defer os.Setenv("GRAPHVIZ_DOT", os.Getenv("GRAPHVIZ_DOT"))
+	os.Setenv("GRAPHVIZ_DOT", "")
+	if got := (Graphviz{}).path(); got != "dot" {
+		t.Fatalf("expected dot, but got %s", got)
+	}
+	os.Setenv("GRAPHVIZ_DOT", "/opt/graphviz/bin/dot")
+	if got := (Graphviz{}).path(); got != "/opt/graphviz/bin/dot" {
+		t.Fatalf("expected $GRAPHVIZ_DOT, but got %s", got)
+	}
+	if got := (Graphviz{Path: "/usr/bin/dot"}).path(); got != "/usr/bin/dot" {
+		t.Fatalf("expected the Path, but got %s", got)
+	}
+}
+
+func TestGraphvizNotFound(t *testing.T) {
+	for _, path := range []string{"relapseviz-no-such-graphviz", filepath.Join(os.TempDir(), "relapseviz", "no", "dot")} {
+		err := Graphviz{Path: path}.MassageSVG()(strings.NewReader(layoutGraph), new(bytes.Buffer))
+		var notFound *GraphvizNotFoundError
+		if !errors.As(err, &notFound) {
+			t.Fatalf("expected a GraphvizNotFoundError, but got %#v", err)
+		}
+	}
+}
+
+func TestGraphvizFailed(t *testing.T) {
+	path := graphviztest.Fake(t, `echo "Error: <stdin>: syntax error in line 1" >&2; exit 1`)
+	defer os.RemoveAll(filepath.Dir(path))
+	err := Graphviz{Path: path}.MassageSVG()(strings.NewReader(layoutGraph), new(bytes.Buffer))
+	var failed *GraphvizError
+	if !errors.As(err, &failed) {
+		t.Fatalf("expected a GraphvizError, but got %#v", err)
+	}
+	if failed.Stderr != "Error: <stdin>: syntax error in line 1" {
+		t.Fatalf("expected the stderr of graphviz, but got %q", failed.Stderr)
+	}
+}
+
+func TestGraphvizContext(t *testing.T) {
+	path := graphviztest.Fake(t, `exec sleep 10`)
+	defer os.RemoveAll(filepath.Dir(path))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := Graphviz{Path: path}.MassageSVGContext(ctx)(strings.NewReader(layoutGraph), new(bytes.Buffer))
+	var failed *GraphvizError
+	if !errors.As(err, &failed) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a GraphvizError for the deadline, but got %#v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("expected graphviz to be killed, but it ran for %v", d)
+	}
+}
+
+// element is a start element of the svg at its depth, where the svg element is at depth 0.
+type element struct {
+	depth int
+	start xml.StartElement
+}
+
+// outline returns the elements of the svg and its text, without the text of scripts.
+func outline(t *testing.T, svg []byte) ([]element, string) {
+	d := xml.NewDecoder(bytes.NewReader(svg))
+	var elements []element
+	var stack []string
+	text := &strings.Builder{}
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return elements, text.String()
+		}
+		if err != nil {
+			t.Fatalf("malformed svg: %v\n%s", err, svg)
+		}
+		switch v := tok.(type) {
+		case xml.StartElement:
+			elements = append(elements, element{len(stack), v.Copy()})
+			stack = append(stack, v.Name.Local)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 && stack[len(stack)-1] != "script" {
+				text.Write(v)
+			}
+		}
+	}
+}
+
+func attr(e xml.StartElement, name string) (string, bool) {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// The testdata holds the svg of the same small graph, written by hand in the output formats of several Graphviz versions,
+// and of a graph with an id, links and html entities, which changes the ids of its g elements.
+// The testdata README explains how to replace them with captures of a real dot binary.
+func TestMassageSVG(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.svg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("expected svg files in testdata")
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			input, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output, err := massageSVG(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// dot does not escape every ampersand, which massageSVG works around
+			want, wantText := outline(t, bytes.Replace(input, []byte("&;"), []byte("&amp;;"), -1))
+			got, gotText := outline(t, output)
+			if len(got) != len(want)+2 {
+				t.Fatalf("expected the script and viewport to be added to the %d elements, but got %d elements", len(want), len(got))
+			}
+			svg := got[0].start
+			if w, _ := attr(svg, "width"); w != "100%" {
+				t.Fatalf("expected the width to be 100%%, but got %q", w)
+			}
+			if h, _ := attr(svg, "height"); h != "100%" {
+				t.Fatalf("expected the height to be 100%%, but got %q", h)
+			}
+			if _, ok := attr(svg, "viewBox"); ok {
+				t.Fatal("expected the viewBox to be removed")
+			}
+			if got[1].depth != 1 || got[1].start.Name.Local != "script" {
+				t.Fatalf("expected the pan script as the first child of the svg element, but got %v", got[1].start.Name)
+			}
+			if id, _ := attr(got[2].start, "id"); got[2].depth != 1 || id != "viewport" {
+				t.Fatalf("expected the viewport as the second child of the svg element, but got %v", got[2].start)
+			}
+			for i, e := range got[3:] {
+				w := want[i+1]
+				if e.depth != w.depth+1 || !reflect.DeepEqual(e.start, w.start) {
+					t.Fatalf("expected %v at depth %d inside the viewport, but got %v at depth %d", w.start, w.depth+1, e.start, e.depth)
+				}
+			}
+			if gotText != wantText {
+				t.Fatalf("expected the text %q, but got %q", wantText, gotText)
+			}
+			if bytes.Contains(input, []byte("xlink:href")) && !bytes.Contains(output, []byte(`xlink:href="`)) {
+				t.Fatal("expected the xlink prefix to be kept")
+			}
+			if embedded := Embeddable(string(output)); strings.Contains(embedded, "<script") || !strings.HasPrefix(embedded, "<svg") {
+				t.Fatalf("expected the svg without the script to be embeddable, but got %s", embedded)
+			}
+		})
+	}
+}
+
+func TestMassageSVGMalformed(t *testing.T) {
+	for _, svg := range []string{
+		``,
+		`<svg xmlns="http://www.w3.org/2000/svg"><g id="graph0"></svg>`,
+		`<svg xmlns="http://www.w3.org/2000/svg"><text>a < b</text></svg>`,
+		`<html><body></body></html>`,
+	} {
+		_, err := massageSVG([]byte(svg))
+		var malformed *MalformedSVGError
+		if !errors.As(err, &malformed) {
+			t.Fatalf("expected a MalformedSVGError for %s, but got %#v", svg, err)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package relapseviz
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+// Theme styles the nodes by their kind, which is the ast type name of the node,
+// such as TreeNode, LeafNode, Or, And, Not, Reference, Keyword, Space, Terminal, Variable, Function or BuiltIn.
+// A theme can be loaded from a json file with LoadTheme, for example
+//
+//	{
+//		"graph": {"bgcolor": "white"},
+//		"node": {"fontname": "Helvetica"},
+//		"kinds": {
+//			"TreeNode": {"shape": "box", "fillcolor": "lightblue"},
+//			"Keyword": {"fontcolor": "grey40", "edgestyle": "dotted"}
+//		}
+//	}
+type Theme struct {
+	// Graph are graphviz attributes of the graph, such as bgcolor.
+	Graph map[string]string `json:"graph,omitempty"`
+	// Node is the style of every node, which the style of its kind overrides.
+	Node Style `json:"node,omitempty"`
+	// Kinds are the styles of the nodes of each kind.
+	Kinds map[string]Style `json:"kinds,omitempty"`
+}
+
+// Style is the look of a kind of node and of the edges to it, where empty fields are left to graphviz.
+type Style struct {
+	Shape string `json:"shape,omitempty"`
+	// Style is the graphviz style of the node, such as rounded, to which filled is added if FillColor is set.
+	Style     string `json:"style,omitempty"`
+	FillColor string `json:"fillcolor,omitempty"`
+	Color     string `json:"color,omitempty"`
+	FontName  string `json:"fontname,omitempty"`
+	FontColor string `json:"fontcolor,omitempty"`
+	FontSize  string `json:"fontsize,omitempty"`
+	// EdgeStyle and EdgeColor are the graphviz style and color of the edges to the node,
+	// which are labelled in the font of the node.
+	EdgeStyle string `json:"edgestyle,omitempty"`
+	EdgeColor string `json:"edgecolor,omitempty"`
+}
+
+// LightTheme returns a theme which draws every kind of node in its own pastel color on a white background.
+func LightTheme() *Theme {
+	return &Theme{
+		Graph: map[string]string{"bgcolor": "white", "fontname": "Helvetica"},
+		Node:  Style{FontName: "Helvetica", FontSize: "11"},
+		Kinds: map[string]Style{
+			"TreeNode":  {Shape: "box", Style: "rounded", FillColor: "#dae8fc", Color: "#6c8ebf"},
+			"LeafNode":  {Shape: "box", FillColor: "#d5e8d4", Color: "#82b366"},
+			"Or":        {Shape: "diamond", FillColor: "#fff2cc", Color: "#d6b656"},
+			"And":       {Shape: "diamond", FillColor: "#ffe6cc", Color: "#d79b00"},
+			"Not":       {Shape: "diamond", FillColor: "#f8cecc", Color: "#b85450"},
+			"Reference": {Shape: "box", Style: "dashed", FillColor: "#e1d5e7", Color: "#9673a6", EdgeStyle: "dashed"},
+			"Keyword":   {Shape: "plaintext", FontColor: "#666666", EdgeStyle: "dotted", EdgeColor: "#999999"},
+			"Space":     {Shape: "note", FontColor: "#999999", Color: "#999999", EdgeStyle: "dotted", EdgeColor: "#999999"},
+			"Terminal":  {Shape: "box", FillColor: "#f5f5f5", Color: "#666666"},
+			"Variable":  {Shape: "box", Style: "rounded", FillColor: "#f5f5f5", Color: "#666666"},
+			"Function":  {Shape: "component", FillColor: "#fff2cc", Color: "#d6b656"},
+			"BuiltIn":   {Shape: "component", FillColor: "#ffe6cc", Color: "#d79b00"},
+		},
+	}
+}
+
+// DarkTheme returns a theme which draws light text and muted colors on a dark background.
+func DarkTheme() *Theme {
+	return &Theme{
+		Graph: map[string]string{"bgcolor": "#1e1e1e", "fontname": "Helvetica", "fontcolor": "#d4d4d4"},
+		Node:  Style{FontName: "Helvetica", FontSize: "11", FontColor: "#d4d4d4", Color: "#808080", EdgeColor: "#a0a0a0"},
+		Kinds: map[string]Style{
+			"TreeNode":  {Shape: "box", Style: "rounded", FillColor: "#264f78", Color: "#569cd6"},
+			"LeafNode":  {Shape: "box", FillColor: "#2d4a2b", Color: "#6a9955"},
+			"Or":        {Shape: "diamond", FillColor: "#4d4420", Color: "#dcdcaa"},
+			"And":       {Shape: "diamond", FillColor: "#5a3d1e", Color: "#ce9178"},
+			"Not":       {Shape: "diamond", FillColor: "#5a1d1d", Color: "#f14c4c"},
+			"Reference": {Shape: "box", Style: "dashed", FillColor: "#3c2d4a", Color: "#c586c0", EdgeStyle: "dashed"},
+			"Keyword":   {Shape: "plaintext", FontColor: "#808080", EdgeStyle: "dotted", EdgeColor: "#606060"},
+			"Space":     {Shape: "note", FontColor: "#606060", Color: "#606060", EdgeStyle: "dotted", EdgeColor: "#606060"},
+			"Terminal":  {Shape: "box", FillColor: "#333333", Color: "#9cdcfe"},
+			"Variable":  {Shape: "box", Style: "rounded", FillColor: "#333333", Color: "#9cdcfe"},
+			"Function":  {Shape: "component", FillColor: "#4d4420", Color: "#dcdcaa"},
+			"BuiltIn":   {Shape: "component", FillColor: "#5a3d1e", Color: "#ce9178"},
+		},
+	}
+}
+
+// PrintTheme returns a theme which tells the kinds of nodes apart by their shape and line style in greyscale,
+// to print on paper.
+func PrintTheme() *Theme {
+	return &Theme{
+		Graph: map[string]string{"bgcolor": "white", "fontname": "Times"},
+		Node:  Style{FontName: "Times", FontSize: "11", Color: "black", FontColor: "black", EdgeColor: "black"},
+		Kinds: map[string]Style{
+			"TreeNode":  {Shape: "box", Style: "rounded", FillColor: "#e0e0e0"},
+			"LeafNode":  {Shape: "box", FillColor: "white"},
+			"Or":        {Shape: "diamond", FillColor: "white"},
+			"And":       {Shape: "diamond", Style: "bold", FillColor: "white"},
+			"Not":       {Shape: "diamond", FillColor: "#c0c0c0"},
+			"Reference": {Shape: "box", Style: "dashed", EdgeStyle: "dashed"},
+			"Keyword":   {Shape: "plaintext", FontColor: "#404040", EdgeStyle: "dotted"},
+			"Space":     {Shape: "note", FontColor: "#808080", Color: "#808080", EdgeStyle: "dotted", EdgeColor: "#808080"},
+			"Terminal":  {Shape: "box", FillColor: "#f0f0f0"},
+			"Variable":  {Shape: "box", Style: "rounded", FillColor: "#f0f0f0"},
+			"Function":  {Shape: "component", FillColor: "#f0f0f0"},
+			"BuiltIn":   {Shape: "component", FillColor: "#e0e0e0"},
+		},
+	}
+}
+
+// themes are the built-in themes by name.
+var themes = map[string]func() *Theme{
+	"light": LightTheme,
+	"dark":  DarkTheme,
+	"print": PrintTheme,
+}
+
+// LoadTheme returns a new copy of the built-in theme with the name, which is light, dark or print,
+// or else loads the theme from the json file.
+func LoadTheme(name string) (*Theme, error) {
+	if theme, ok := themes[name]; ok {
+		return theme(), nil
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	theme := &Theme{}
+	if err := json.Unmarshal(data, theme); err != nil {
+		return nil, fmt.Errorf("theme %s: %v", name, err)
+	}
+	return theme, nil
+}
+
+// graphAttrs returns the graphviz attributes of the graph.
+func (th *Theme) graphAttrs() map[string]string {
+	if th == nil {
+		return nil
+	}
+	attrs := make(map[string]string, len(th.Graph))
+	for field, value := range th.Graph {
+		attrs[field] = quote(escape(value))
+	}
+	return attrs
+}
+
+// nodeAttrs returns the graphviz attributes of the nodes of the kind.
+func (th *Theme) nodeAttrs(kind string) map[string]string {
+	if th == nil {
+		return nil
+	}
+	return th.style(kind).nodeAttrs()
+}
+
+// edgeAttrs returns the graphviz attributes of the edges to the nodes of the kind.
+func (th *Theme) edgeAttrs(kind string) map[string]string {
+	if th == nil {
+		return nil
+	}
+	return th.style(kind).edgeAttrs()
+}
+
+// style returns the style of the kind, where the empty fields are filled in from the style of every node.
+func (th *Theme) style(kind string) Style {
+	s, d := th.Kinds[kind], th.Node
+	return Style{
+		Shape:     or(s.Shape, d.Shape),
+		Style:     or(s.Style, d.Style),
+		FillColor: or(s.FillColor, d.FillColor),
+		Color:     or(s.Color, d.Color),
+		FontName:  or(s.FontName, d.FontName),
+		FontColor: or(s.FontColor, d.FontColor),
+		FontSize:  or(s.FontSize, d.FontSize),
+		EdgeStyle: or(s.EdgeStyle, d.EdgeStyle),
+		EdgeColor: or(s.EdgeColor, d.EdgeColor),
+	}
+}
+
+func (s Style) nodeAttrs() map[string]string {
+	style := s.Style
+	if s.FillColor != "" {
+		style = strings.TrimPrefix(style+",filled", ",")
+	}
+	return setAttrs(map[gographviz.Attr]string{
+		gographviz.Shape:     s.Shape,
+		gographviz.Style:     style,
+		gographviz.FillColor: s.FillColor,
+		gographviz.Color:     s.Color,
+		gographviz.FontName:  s.FontName,
+		gographviz.FontColor: s.FontColor,
+		gographviz.FontSize:  s.FontSize,
+	})
+}
+
+func (s Style) edgeAttrs() map[string]string {
+	return setAttrs(map[gographviz.Attr]string{
+		gographviz.Style:     s.EdgeStyle,
+		gographviz.Color:     s.EdgeColor,
+		gographviz.FontName:  s.FontName,
+		gographviz.FontColor: s.FontColor,
+		gographviz.FontSize:  s.FontSize,
+	})
+}
+
+// setAttrs returns the quoted graphviz attributes which are set.
+func setAttrs(m map[gographviz.Attr]string) map[string]string {
+	attrs := make(map[string]string, len(m))
+	for field, value := range m {
+		if value != "" {
+			attrs[string(field)] = quote(escape(value))
+		}
+	}
+	return attrs
+}
+
+// or returns the first of the strings which is not empty.
+func or(ss ...string) string {
+	for _, s := range ss {
+		if s != "" {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,196 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package relapseviz
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/awalterschulze/gographviz"
+	"github.com/jmarais/relapseviz/automaton"
+	"github.com/katydid/katydid/relapse/ast"
+)
+
+// Frame is the graph of the derivatives of a grammar after a single event of the tree walk over an input.
+// The derivatives are those of automaton.Trace, which approximate the validation of katydid, instead of being its steps.
+type Frame struct {
+	// Label is the number and description of the event, such as 3: leave "A",
+	// which is also the label of the graph.
+	Label string
+	Graph *gographviz.Graph
+}
+
+// TranslateTrace validates the input, such as a json document parsed by katydid's parser/json, against the grammar
+// with the derivatives of automaton.Trace and translates the derivatives at the start and after every field which is entered or left
+// with TranslateGrammar, to see where a validation fails, which is where the top level pattern becomes !(*).
+// Every frame translates a grammar with a pattern declaration for each of the patterns at each depth,
+// named main for the top level and level<depth>_<index> below it, such as level2_0 for the first pattern of the children of "B" in "A"."B".
+// The graph is labelled with the event, the path of the entered fields and which of the patterns are nullable,
+// where the label of the last frame also says whether the input is valid, and with a note that they are an approximation.
+// The derivatives and their simplification are relapseviz's own and not katydid's,
+// so the frames approximate how katydid validates the input, where only the validity at the end is checked against katydid.
+// Options.Focus is ignored, since the frames do not hold the pattern declarations of the grammar, use Focus instead.
+// It returns an *automaton.MismatchError if the derivatives and katydid disagree on whether the input is valid.
+func TranslateTrace(g *ast.Grammar, p automaton.Parser, opts Options) ([]*Frame, error) {
+	opts.Focus = ""
+	steps, err := automaton.Trace(g, p)
+	if err != nil {
+		return nil, err
+	}
+	frames := make([]*Frame, len(steps))
+	for i, s := range steps {
+		graph, err := TranslateGrammar(stepGrammar(s), opts)
+		if err != nil {
+			return nil, err
+		}
+		label := fmt.Sprintf("%d: %s", i, s.Event)
+		if i == len(steps)-1 {
+			if s.Valid() {
+				label += " (valid)"
+			} else {
+				label += " (invalid)"
+			}
+		}
+		graphLabel := label + "\npath: " + strings.Join(s.Path, ".")
+		if names := nullableDecls(s); len(names) > 0 {
+			graphLabel += "\nnullable: " + strings.Join(names, ", ")
+		}
+		graphLabel += "\n" + approximationNote
+		if err := graph.AddAttr(graph.Name, attrLabel, quote(escape(graphLabel))); err != nil {
+			return nil, &GraphError{Err: err}
+		}
+		frames[i] = &Frame{Label: label, Graph: graph}
+	}
+	return frames, nil
+}
+
+// approximationNote labels the frames, so that they are not taken for the steps of katydid.
+const approximationNote = "relapseviz derivatives, an approximation of katydid's validation"
+
+// stepGrammar returns a grammar with a pattern declaration for each of the patterns of the step.
+func stepGrammar(s *automaton.Step) *ast.Grammar {
+	g := &ast.Grammar{}
+	for depth, ps := range s.Patterns {
+		for i, p := range ps {
+			g.PatternDecls = append(g.PatternDecls, ast.NewPatternDecl(stepDeclName(depth, i), p))
+		}
+	}
+	return g
+}
+
+func stepDeclName(depth, i int) string {
+	if depth == 0 {
+		return "main"
+	}
+	return fmt.Sprintf("level%d_%d", depth, i)
+}
+
+// nullableDecls returns the names of the pattern declarations of the nullable patterns of the step.
+func nullableDecls(s *automaton.Step) []string {
+	var names []string
+	for depth, ns := range s.Nullable {
+		for i, n := range ns {
+			if n {
+				names = append(names, stepDeclName(depth, i))
+			}
+		}
+	}
+	return names
+}
+
+// WriteTraceHTML writes the frames as a single html page with a slider, laid out with the built-in layout.
+func WriteTraceHTML(frames []*Frame, w io.Writer) error {
+	return Renderer{BuiltinLayout: true}.WriteTraceHTML(frames, w)
+}
+
+// WriteTraceHTML writes the frames as a single html page with a slider, and buttons and arrow keys,
+// to step through the frames, where every frame is embedded as pannable svg.
+func (r Renderer) WriteTraceHTML(frames []*Frame, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, traceHeader, len(frames)-1, html.EscapeString(approximationNote))
+	for i, f := range frames {
+		svg := new(bytes.Buffer)
+		if err := r.WriteSVG(f.Graph, svg); err != nil {
+			return fmt.Errorf("frame %s: %v", f.Label, err)
+		}
+		hidden := ""
+		if i > 0 {
+			hidden = " hidden"
+		}
+		// the svg is embedded as a document of its own, so that its panning script only sees its own elements
+		fmt.Fprintf(bw, "<iframe class=\"frame\" title=\"%s\" src=\"data:image/svg+xml;base64,%s\"%s></iframe>\n",
+			html.EscapeString(f.Label), base64.StdEncoding.EncodeToString(svg.Bytes()), hidden)
+	}
+	fmt.Fprint(bw, traceFooter)
+	return bw.Flush()
+}
+
+const traceHeader = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>relapseviz trace (approximate derivatives)</title>
+<style>
+body { margin: 0; height: 100vh; display: flex; flex-direction: column; font-family: sans-serif; }
+#controls { display: flex; align-items: center; gap: 8px; padding: 8px; border-bottom: 1px solid #ccc; }
+#slider { flex: 1; }
+#event { min-width: 20em; font-family: monospace; }
+#note { color: #666; }
+iframe { flex: 1; width: 100%%; border: none; }
+iframe[hidden] { display: none; }
+</style>
+</head>
+<body>
+<div id="controls">
+<button id="prev" title="previous event">&#9664;</button>
+<input id="slider" type="range" min="0" max="%d" value="0">
+<button id="next" title="next event">&#9654;</button>
+<span id="event"></span>
+<span id="note">%s</span>
+</div>
+`
+
+const traceFooter = `<script>
+var views = document.querySelectorAll("iframe.frame");
+var slider = document.getElementById("slider");
+var caption = document.getElementById("event");
+function show(i) {
+	i = Math.max(0, Math.min(views.length - 1, i));
+	slider.value = i;
+	for (var j = 0; j < views.length; j++) {
+		views[j].hidden = j != i;
+	}
+	caption.textContent = views[i].title;
+}
+slider.oninput = function() { show(+slider.value); };
+document.getElementById("prev").onclick = function() { show(+slider.value - 1); };
+document.getElementById("next").onclick = function() { show(+slider.value + 1); };
+document.onkeydown = function(e) {
+	if (e.key == "ArrowLeft") {
+		show(+slider.value - 1);
+	} else if (e.key == "ArrowRight") {
+		show(+slider.value + 1);
+	}
+};
+show(0);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,426 @@
+//  Copyright 2019 Jacques Marais
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package relapseviz
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/awalterschulze/gographviz"
+	"github.com/jmarais/relapseviz/svg"
+)
+
+// WriteHTML writes the graph as a self-contained interactive html page, laid out with the built-in layout.
+func WriteHTML(graph *gographviz.Graph, w io.Writer) error {
+	return Renderer{BuiltinLayout: true}.WriteHTML(graph, w)
+}
+
+// WriteHTML writes the graph as a single html page, with its script inline so that it needs no network access,
+// built on the svg written by WriteSVG.
+// The graph is panned by dragging and zoomed with the mouse wheel, a click on a node collapses or expands its subtree,
+// the search box highlights the nodes whose name, label or source contains the text,
+// hovering over a node shows its relapse source, if it was translated with Options.Sources,
+// and a minimap shows which part of the graph is in view.
+func (r Renderer) WriteHTML(graph *gographviz.Graph, w io.Writer) error {
+	s := new(bytes.Buffer)
+	if err := r.WriteSVG(graph, s); err != nil {
+		return err
+	}
+	data, err := json.Marshal(newViewerGraph(graph))
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, viewerHeader, html.EscapeString(idText(graph.Name)))
+	bw.WriteString(svg.Embeddable(s.String()))
+	// json.Marshal escapes <, > and &, so that the data cannot end the script element
+	fmt.Fprintf(bw, "</div>\n<script type=\"application/json\" id=\"graph\">%s</script>\n", data)
+	bw.WriteString(viewerFooter)
+	return bw.Flush()
+}
+
+// viewerGraph is the structure of the graph, which the script of the html page
+// matches to the svg elements by their titles.
+type viewerGraph struct {
+	Nodes []viewerNode `json:"nodes"`
+	Edges []viewerEdge `json:"edges"`
+}
+
+type viewerNode struct {
+	Name   string `json:"name"`
+	Label  string `json:"label"`
+	Source string `json:"source,omitempty"`
+}
+
+type viewerEdge struct {
+	Src  string `json:"src"`
+	Port string `json:"port,omitempty"`
+	Dst  string `json:"dst"`
+}
+
+func newViewerGraph(graph *gographviz.Graph) *viewerGraph {
+	v := &viewerGraph{Nodes: []viewerNode{}, Edges: []viewerEdge{}}
+	for _, n := range graph.Nodes.Nodes {
+		node := viewerNode{Name: idText(n.Name), Label: labelText(n.Attrs[gographviz.Label])}
+		if tooltip, ok := n.Attrs[gographviz.Tooltip]; ok {
+			node.Source = unquoteDot(tooltip)
+		}
+		v.Nodes = append(v.Nodes, node)
+	}
+	for _, e := range graph.Edges.Edges {
+		v.Edges = append(v.Edges, viewerEdge{Src: idText(e.Src), Port: e.SrcPort, Dst: idText(e.Dst)})
+	}
+	return v
+}
+
+// idText returns the text of a dot id as it is written into the titles of the svg,
+// where only the escaped quotes of a quoted id are unescaped.
+func idText(id string) string {
+	if len(id) < 2 || id[0] != '"' || id[len(id)-1] != '"' {
+		return id
+	}
+	return strings.Replace(id[1:len(id)-1], `\"`, `"`, -1)
+}
+
+const viewerHeader = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style>
+body { margin: 0; height: 100vh; display: flex; flex-direction: column; font-family: sans-serif; }
+#controls { display: flex; align-items: center; gap: 8px; padding: 8px; border-bottom: 1px solid #ccc; }
+#search { width: 20em; }
+#count, #hint { color: #666; font-size: small; }
+#hint { margin-left: auto; }
+#view { flex: 1; position: relative; overflow: hidden; cursor: grab; }
+#view > svg { position: absolute; width: 100%%; height: 100%%; }
+#minimap { position: absolute; right: 12px; bottom: 12px; width: 200px; height: 150px; background: white; border: 1px solid #999; box-shadow: 0 1px 4px rgba(0,0,0,.3); cursor: pointer; }
+#minimap svg { width: 100%%; height: 100%%; pointer-events: none; }
+#minimap .lens { fill: rgba(30,144,255,.15); stroke: dodgerblue; stroke-width: 2; }
+#tooltip { position: fixed; display: none; max-width: 40em; padding: 4px 6px; background: #ffffe0; border: 1px solid #999; font-family: monospace; font-size: 12px; white-space: pre-wrap; pointer-events: none; }
+g.node { cursor: pointer; }
+g.node.match polygon, g.node.match ellipse, g.node.match rect, g.node.match path { stroke: #e8590c; stroke-width: 3px; }
+g.node.dim, g.edge.dim { opacity: .25; }
+g.node.collapsed polygon, g.node.collapsed ellipse, g.node.collapsed rect, g.node.collapsed path { stroke-dasharray: 6,3; stroke-width: 2.5px; }
+</style>
+</head>
+<body>
+<div id="controls">
+<input id="search" type="search" placeholder="search by type or label, enter for the next match">
+<span id="count"></span>
+<button id="fit" title="fit the graph into view">fit</button>
+<button id="expand" title="expand every collapsed node">expand all</button>
+<span id="hint">drag to pan, scroll to zoom, click a node to collapse or expand it, ctrl+click to follow its link</span>
+</div>
+<div id="view">
+`
+
+const viewerFooter = `<div id="minimap"></div>
+<div id="tooltip"></div>
+<script>
+(function() {
+var data = JSON.parse(document.getElementById("graph").textContent);
+var view = document.getElementById("view");
+var svg = view.querySelector("svg");
+var viewport = svg.querySelector("#viewport") || svg.querySelector("g");
+var tooltip = document.getElementById("tooltip");
+
+// the minimap is a copy of the graph before it is changed, without ids so that they stay unique
+var mini = svg.cloneNode(true);
+var miniViewport = mini.querySelector("#viewport") || mini.querySelector("g");
+miniViewport.removeAttribute("transform");
+var all = mini.querySelectorAll("[id]");
+for (var i = 0; i < all.length; i++) {
+	all[i].removeAttribute("id");
+}
+var mainItems = svg.querySelectorAll("g.node, g.edge");
+var miniItems = mini.querySelectorAll("g.node, g.edge");
+
+// index the elements of the nodes and edges by their titles, which are removed,
+// together with the titles of the links, to show the tooltip instead
+function titled(selector) {
+	var m = {};
+	var gs = svg.querySelectorAll(selector);
+	for (var i = 0; i < gs.length; i++) {
+		var t = gs[i].querySelector("title");
+		if (!t) {
+			continue;
+		}
+		(m[t.textContent] = m[t.textContent] || []).push(gs[i]);
+		t.parentNode.removeChild(t);
+		var as = gs[i].querySelectorAll("a");
+		for (var j = 0; j < as.length; j++) {
+			as[j].removeAttributeNS("http://www.w3.org/1999/xlink", "title");
+			as[j].removeAttribute("title");
+		}
+	}
+	return m;
+}
+var nodeEls = titled("g.node");
+var edgeEls = titled("g.edge");
+
+var nodes = {};
+var names = [];
+data.nodes.forEach(function(n) {
+	var els = nodeEls[n.name];
+	if (!els) {
+		return;
+	}
+	nodes[n.name] = {name: n.name, el: els[0], text: (n.name + "\n" + n.label + "\n" + (n.source || "")).toLowerCase(), source: n.source || n.label, out: [], in: []};
+	names.push(n.name);
+});
+var edges = [];
+data.edges.forEach(function(e) {
+	var els = edgeEls[e.src + "->" + e.dst] || edgeEls[e.src + ":" + e.port + "->" + e.dst];
+	if (!nodes[e.src] || !nodes[e.dst]) {
+		return;
+	}
+	var edge = {src: e.src, dst: e.dst, el: els && els.length > 0 ? els.shift() : null};
+	nodes[e.src].out.push(edge);
+	nodes[e.dst].in.push(edge);
+	edges.push(edge);
+});
+
+// collapse and expand: the nodes which are only reached from the roots through a collapsed node are hidden
+var collapsed = {};
+var roots = names.filter(function(n) { return nodes[n].in.length == 0; });
+function reach(stopAtCollapsed) {
+	var seen = {};
+	var stack = roots.slice();
+	while (stack.length > 0) {
+		var n = stack.pop();
+		if (seen[n]) {
+			continue;
+		}
+		seen[n] = true;
+		if (stopAtCollapsed && collapsed[n]) {
+			continue;
+		}
+		nodes[n].out.forEach(function(e) { stack.push(e.dst); });
+	}
+	return seen;
+}
+var reachable = reach(false);
+var visible = reachable;
+function shown(n) {
+	return !reachable[n] || visible[n];
+}
+function update() {
+	visible = reach(true);
+	names.forEach(function(n) {
+		nodes[n].el.style.display = shown(n) ? "" : "none";
+		nodes[n].el.classList.toggle("collapsed", !!collapsed[n]);
+	});
+	edges.forEach(function(e) {
+		if (e.el) {
+			e.el.style.display = shown(e.src) && shown(e.dst) && !collapsed[e.src] ? "" : "none";
+		}
+	});
+	for (var i = 0; i < mainItems.length && i < miniItems.length; i++) {
+		miniItems[i].style.display = mainItems[i].style.display;
+	}
+}
+function toggle(n) {
+	if (nodes[n].out.length == 0) {
+		return;
+	}
+	if (collapsed[n]) {
+		delete collapsed[n];
+	} else {
+		collapsed[n] = true;
+	}
+	update();
+}
+// reveal expands the collapsed nodes above the node
+function reveal(n) {
+	var seen = {};
+	var stack = [n];
+	while (stack.length > 0) {
+		var m = stack.pop();
+		if (seen[m]) {
+			continue;
+		}
+		seen[m] = true;
+		nodes[m].in.forEach(function(e) {
+			delete collapsed[e.src];
+			stack.push(e.src);
+		});
+	}
+	update();
+}
+
+// pan and zoom
+var scale = 1, tx = 0, ty = 0;
+var bounds = viewport.getBBox();
+var lens = document.createElementNS("http://www.w3.org/2000/svg", "rect");
+lens.setAttribute("class", "lens");
+lens.setAttribute("vector-effect", "non-scaling-stroke");
+mini.appendChild(lens);
+mini.setAttribute("viewBox", bounds.x + " " + bounds.y + " " + bounds.width + " " + bounds.height);
+mini.setAttribute("width", "100%");
+mini.setAttribute("height", "100%");
+document.getElementById("minimap").appendChild(mini);
+function apply() {
+	viewport.setAttribute("transform", "translate(" + tx + "," + ty + ") scale(" + scale + ")");
+	lens.setAttribute("x", -tx / scale);
+	lens.setAttribute("y", -ty / scale);
+	lens.setAttribute("width", view.clientWidth / scale);
+	lens.setAttribute("height", view.clientHeight / scale);
+}
+function fit() {
+	var w = view.clientWidth, h = view.clientHeight;
+	scale = Math.min(2, 0.95 * Math.min(w / bounds.width, h / bounds.height));
+	tx = (w - bounds.width * scale) / 2 - bounds.x * scale;
+	ty = (h - bounds.height * scale) / 2 - bounds.y * scale;
+	apply();
+}
+function center(x, y) {
+	tx = view.clientWidth / 2 - x * scale;
+	ty = view.clientHeight / 2 - y * scale;
+	apply();
+}
+view.addEventListener("wheel", function(e) {
+	e.preventDefault();
+	var r = view.getBoundingClientRect();
+	var x = e.clientX - r.left, y = e.clientY - r.top;
+	var z = e.deltaY < 0 ? 1.1 : 1 / 1.1;
+	tx = x - (x - tx) * z;
+	ty = y - (y - ty) * z;
+	scale *= z;
+	apply();
+}, {passive: false});
+var drag = null, dragged = false;
+svg.addEventListener("mousedown", function(e) {
+	drag = {x: e.clientX, y: e.clientY, tx: tx, ty: ty};
+	dragged = false;
+	e.preventDefault();
+});
+window.addEventListener("mousemove", function(e) {
+	if (!drag) {
+		return;
+	}
+	var dx = e.clientX - drag.x, dy = e.clientY - drag.y;
+	if (Math.abs(dx) + Math.abs(dy) > 3) {
+		dragged = true;
+	}
+	tx = drag.tx + dx;
+	ty = drag.ty + dy;
+	apply();
+});
+window.addEventListener("mouseup", function() { drag = null; });
+window.addEventListener("resize", apply);
+
+// the minimap centers the view where it is clicked or dragged
+var minimap = document.getElementById("minimap");
+function follow(e) {
+	var p = mini.createSVGPoint();
+	p.x = e.clientX;
+	p.y = e.clientY;
+	p = p.matrixTransform(mini.getScreenCTM().inverse());
+	center(p.x, p.y);
+}
+var following = false;
+minimap.addEventListener("mousedown", function(e) { following = true; follow(e); e.preventDefault(); });
+window.addEventListener("mousemove", function(e) { if (following) { follow(e); } });
+window.addEventListener("mouseup", function() { following = false; });
+
+// clicks and tooltips on the nodes
+names.forEach(function(n) {
+	var el = nodes[n].el;
+	el.addEventListener("click", function(e) {
+		if (dragged) {
+			e.preventDefault();
+			return;
+		}
+		if (e.ctrlKey || e.metaKey) {
+			return;
+		}
+		e.preventDefault();
+		toggle(n);
+	});
+	el.addEventListener("mousemove", function(e) {
+		if (drag || !nodes[n].source) {
+			return;
+		}
+		tooltip.textContent = nodes[n].source;
+		tooltip.style.display = "block";
+		tooltip.style.left = (e.clientX + 12) + "px";
+		tooltip.style.top = (e.clientY + 12) + "px";
+	});
+	el.addEventListener("mouseleave", function() { tooltip.style.display = "none"; });
+});
+
+// search highlights the matching nodes and dims the rest, where enter centers the next match
+var search = document.getElementById("search");
+var count = document.getElementById("count");
+var matches = [], current = -1;
+search.addEventListener("input", function() {
+	var q = search.value.trim().toLowerCase();
+	matches = [];
+	current = -1;
+	names.forEach(function(n) {
+		var match = q != "" && nodes[n].text.indexOf(q) >= 0;
+		if (match) {
+			matches.push(n);
+		}
+		nodes[n].el.classList.toggle("match", match);
+		nodes[n].el.classList.toggle("dim", q != "" && !match);
+	});
+	edges.forEach(function(e) {
+		if (e.el) {
+			e.el.classList.toggle("dim", q != "");
+		}
+	});
+	count.textContent = q == "" ? "" : matches.length + (matches.length == 1 ? " match" : " matches");
+});
+search.addEventListener("keydown", function(e) {
+	if (e.key == "Escape") {
+		search.value = "";
+		search.dispatchEvent(new Event("input"));
+		return;
+	}
+	if (e.key != "Enter" || matches.length == 0) {
+		return;
+	}
+	current = (current + 1) % matches.length;
+	var n = matches[current];
+	reveal(n);
+	var el = nodes[n].el, b = el.getBBox();
+	var p = svg.createSVGPoint();
+	p.x = b.x + b.width / 2;
+	p.y = b.y + b.height / 2;
+	// the node is inside the transformed graph element, below the viewport
+	p = p.matrixTransform(viewport.getCTM().inverse().multiply(el.getCTM()));
+	center(p.x, p.y);
+	count.textContent = (current + 1) + " of " + matches.length + " matches";
+});
+
+document.getElementById("fit").onclick = fit;
+document.getElementById("expand").onclick = function() {
+	collapsed = {};
+	update();
+};
+fit();
+})();
+</script>
+</body>
+</html>
+`